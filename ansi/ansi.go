@@ -26,6 +26,8 @@ const (
 	Asc        = "ASC"
 	Desc       = "DESC"
 	Limit      = "LIMIT"
+	Offset     = "OFFSET"
+	Fetch      = "FETCH"
 	Insert     = "INSERT"
 	InsertInto = "INSERT INTO"
 	Values     = "VALUES"
@@ -33,7 +35,23 @@ const (
 	Set        = "SET"
 	Delete     = "DELETE"
 	Output     = "OUTPUT"
+	Returning  = "RETURNING"
+	Into       = "INTO"
+	Inserted   = "INSERTED"
+	Deleted    = "DELETED"
 	Using      = "USING"
+	Union      = "UNION"
+	UnionAll   = "UNION ALL"
+	Intersect  = "INTERSECT"
+	Except     = "EXCEPT"
+	Minus      = "MINUS"
+	With       = "WITH"
+	ForUpdate  = "FOR UPDATE"
+	ForShare   = "FOR SHARE"
+	NoWait     = "NOWAIT"
+	SkipLocked = "SKIP LOCKED"
+	Of         = "OF"
+	Recursive  = "RECURSIVE"
 
 	Join      = "JOIN"
 	As        = "AS"
@@ -47,6 +65,7 @@ const (
 
 	And              = "AND"
 	Or               = "OR"
+	Not              = "NOT"
 	OpenParentheses  = "("
 	CloseParentheses = ")"
 	Null             = "NULL"
@@ -61,6 +80,10 @@ const (
 	Equals           = "="
 	NotEquals        = "<>"
 	Between          = "BETWEEN"
+	NotBetween       = "NOT BETWEEN"
+	Escape           = "ESCAPE"
+	IsDistinctFrom   = "IS DISTINCT FROM"
+	IsNotDistinct    = "IS NOT DISTINCT FROM"
 	Like             = "LIKE"
 	NotLike          = "NOT LIKE"
 	In               = "IN"
@@ -71,6 +94,17 @@ const (
 	Exists           = "EXISTS"
 	NotExists        = "NOT EXISTS"
 
+	Over        = "OVER"
+	PartitionBy = "PARTITION BY"
+	Rows        = "ROWS"
+	Range       = "RANGE"
+
+	Case = "CASE"
+	When = "WHEN"
+	Then = "THEN"
+	Else = "ELSE"
+	End  = "END"
+
 	Count = "COUNT"
 	Sum   = "SUM"
 	Avg   = "AVG"
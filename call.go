@@ -0,0 +1,287 @@
+package kdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/sdming/kdb/ansi"
+	"strings"
+)
+
+// FuncResult is result of calling a store procedure by CallFunc
+type FuncResult struct {
+	// Parameters is parameters of procedure, value of out, inout and return parameter is set after calling
+	Parameters []*Parameter
+
+	// ResultSets is rows returned by procedure, each result set is a slice of map[column]value
+	ResultSets [][]map[string]interface{}
+}
+
+// Get return value of parameter by name, name is case insensitive
+func (r *FuncResult) Get(name string) (interface{}, bool) {
+	if p, ok := r.Parameter(name); ok {
+		return p.Value, true
+	}
+	return nil, false
+}
+
+// Parameter return parameter by name, name is case insensitive
+func (r *FuncResult) Parameter(name string) (*Parameter, bool) {
+	for i := 0; i < len(r.Parameters); i++ {
+		if strings.EqualFold(r.Parameters[i].Name, name) {
+			return r.Parameters[i], true
+		}
+	}
+	return nil, false
+}
+
+// Return return value of return parameter
+func (r *FuncResult) Return() (interface{}, bool) {
+	for i := 0; i < len(r.Parameters); i++ {
+		if r.Parameters[i].Dir == ansi.DirReturn {
+			return r.Parameters[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// hasOut return true if there is out, inout or return parameter
+func (r *FuncResult) hasOut() bool {
+	for i := 0; i < len(r.Parameters); i++ {
+		if r.Parameters[i].IsOut() || r.Parameters[i].Dir == ansi.DirReturn {
+			return true
+		}
+	}
+	return false
+}
+
+// setOut set values of out, inout and return parameters from a row
+func (r *FuncResult) setOut(row map[string]interface{}) {
+	for col, v := range row {
+		if p, ok := r.Parameter(col); ok && (p.IsOut() || p.Dir == ansi.DirReturn) {
+			p.Value = v
+		}
+	}
+}
+
+// queryExecer is implemented by *DB, *Tx and *sql.Conn
+type queryExecer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// CallFunc call a store procedure, return values of out, inout and return parameters and result rows
+func (db *DB) CallFunc(name string, args Getter) (*FuncResult, error) {
+	return db.CallFuncContext(context.Background(), name, args)
+}
+
+// CallFuncContext call a store procedure, return values of out, inout and return parameters and result rows
+func (db *DB) CallFuncContext(ctx context.Context, name string, args Getter) (*FuncResult, error) {
+	sp, err := db.buildProcedure(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	dialect, err := db.dialecter()
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect.Name() == "mysql" {
+		// mysql returns out parameters by session variables, all statements must run on one connection
+		conn, err := db.innerdb.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return db.callFunc(ctx, conn, dialect, sp)
+	}
+
+	return db.callFunc(ctx, db, dialect, sp)
+}
+
+// CallFunc call a store procedure, return values of out, inout and return parameters and result rows
+func (tx *Tx) CallFunc(name string, args Getter) (*FuncResult, error) {
+	return tx.CallFuncContext(context.Background(), name, args)
+}
+
+// CallFuncContext call a store procedure, return values of out, inout and return parameters and result rows
+func (tx *Tx) CallFuncContext(ctx context.Context, name string, args Getter) (*FuncResult, error) {
+	sp, err := tx.db.buildProcedure(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	dialect, err := tx.db.dialecter()
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.db.callFunc(ctx, tx, dialect, sp)
+}
+
+func (db *DB) callFunc(ctx context.Context, qe queryExecer, dialect Dialecter, sp *Procedure) (*FuncResult, error) {
+	switch dialect.Name() {
+	case "mysql":
+		return callMysqlFunc(ctx, qe, sp)
+	case "oracle":
+		return db.callOracleFunc(ctx, qe, sp)
+	case "mssql", "postgres":
+		return db.callSelectFunc(ctx, qe, dialect, sp)
+	}
+	return nil, errors.New("driver doesn't support call procedure:" + dialect.Name())
+}
+
+// callMysqlFunc set inout parameters to session variables, call procedure, then select session variables
+func callMysqlFunc(ctx context.Context, qe queryExecer, sp *Procedure) (*FuncResult, error) {
+	result := &FuncResult{Parameters: sp.Parameters}
+	sets, call, selectOut := mysqlProcedureStmts(sp)
+
+	for i := 0; i < len(sets); i++ {
+		if _, err := qe.ExecContext(ctx, sets[i].sql, sets[i].args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if sp.ReturnParameterName() != "" {
+		if _, err := qe.ExecContext(ctx, call.sql, call.args...); err != nil {
+			return nil, err
+		}
+	} else {
+		rows, err := qe.QueryContext(ctx, call.sql, call.args...)
+		if err != nil {
+			return nil, err
+		}
+		err = readResultSets(rows, result)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if selectOut == "" {
+		return result, nil
+	}
+
+	rows, err := qe.QueryContext(ctx, selectOut)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []map[string]interface{}
+	if err = Read(rows, &out); err != nil {
+		return nil, err
+	}
+	if len(out) > 0 {
+		result.setOut(out[0])
+	}
+	return result, nil
+}
+
+// callOracleFunc bind out, inout and return parameters as sql.Out
+func (db *DB) callOracleFunc(ctx context.Context, qe queryExecer, sp *Procedure) (*FuncResult, error) {
+	result := &FuncResult{Parameters: sp.Parameters}
+
+	call := &Procedure{Name: sp.Name, Parameters: make([]*Parameter, len(sp.Parameters))}
+	dests := make([]*interface{}, len(sp.Parameters))
+	for i := 0; i < len(sp.Parameters); i++ {
+		p := *sp.Parameters[i]
+		if p.IsOut() || p.Dir == ansi.DirReturn {
+			dest := new(interface{})
+			*dest = p.Value
+			dests[i] = dest
+			p.Value = sql.Out{Dest: dest, In: p.Dir == ansi.DirInOut}
+		}
+		call.Parameters[i] = &p
+	}
+
+	query, args, err := db.Compile(call)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = qe.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(dests); i++ {
+		if dests[i] != nil {
+			sp.Parameters[i].Value = *dests[i]
+		}
+	}
+	return result, nil
+}
+
+// callSelectFunc read result sets of procedure,
+// sql server selects out parameters in last result set, postgres returns out parameters as columns of single row,
+// rows of postgres function that returns set are kept in result sets
+func (db *DB) callSelectFunc(ctx context.Context, qe queryExecer, dialect Dialecter, sp *Procedure) (*FuncResult, error) {
+	result := &FuncResult{Parameters: sp.Parameters}
+
+	query, args, err := db.Compile(sp)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qe.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	err = readResultSets(rows, result)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.hasOut() || len(result.ResultSets) == 0 {
+		return result, nil
+	}
+
+	var out []map[string]interface{}
+	if dialect.Name() == "mssql" {
+		last := len(result.ResultSets) - 1
+		out = result.ResultSets[last]
+		result.ResultSets = result.ResultSets[:last]
+	} else {
+		// function returns set of rows is kept in result sets, only single row is out parameters
+		out = result.ResultSets[0]
+		if len(out) != 1 {
+			return result, nil
+		}
+		result.ResultSets = result.ResultSets[1:]
+	}
+	if len(out) == 0 {
+		return result, nil
+	}
+
+	result.setOut(out[0])
+	if retName := sp.ReturnParameterName(); retName != "" && len(out[0]) == 1 {
+		// postgres names return column as function name
+		if _, ok := out[0][retName]; !ok {
+			for _, v := range out[0] {
+				ret, _ := result.Parameter(retName)
+				ret.Value = v
+			}
+		}
+	}
+	return result, nil
+}
+
+// readResultSets read all result sets of rows to result.ResultSets
+func readResultSets(rows *sql.Rows, result *FuncResult) error {
+	for {
+		var set []map[string]interface{}
+		if err := Read(rows, &set); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		result.ResultSets = append(result.ResultSets, set)
+
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	return rows.Err()
+}
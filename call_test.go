@@ -0,0 +1,119 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"github.com/sdming/kdb/ansi"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallFuncMssql(t *testing.T) {
+	db, source := newFakeDB(t, "fakemssql")
+	defer db.Close()
+
+	fakeResult(source, "information_schema.ROUTINES", []string{"catalog", "schema", "name"},
+		[]driver.Value{"demo", "dbo", "usp_inout"})
+	fakeResult(source, "information_schema.PARAMETERS", []string{"name", "position", "dirmode", "datatype", "length", "precision", "scale"},
+		[]driver.Value{"x", int64(1), "IN", "int", int64(0), int64(10), int64(0)},
+		[]driver.Value{"y", int64(2), "INOUT", "int", int64(0), int64(10), int64(0)},
+		[]driver.Value{"sum", int64(3), "OUT", "int", int64(0), int64(10), int64(0)})
+	fakeResult(source, "exec usp_inout", []string{"y", "sum"}, []driver.Value{int64(3), int64(5)})
+
+	result, err := db.CallFunc("usp_inout", Map{"x": 1, "y": 2})
+	if err != nil {
+		t.Fatal("CallFunc error", err)
+	}
+
+	if v, _ := result.Get("x"); v != 1 {
+		t.Errorf("CallFunc in parameter error; actual=[%v]", v)
+	}
+	if v, _ := result.Get("y"); v != int64(3) {
+		t.Errorf("CallFunc inout parameter error; actual=[%v]", v)
+	}
+	if v, _ := result.Get("SUM"); v != int64(5) {
+		t.Errorf("CallFunc out parameter error; actual=[%v]", v)
+	}
+	if len(result.ResultSets) != 0 {
+		t.Errorf("CallFunc result sets error; actual=[%v]", result.ResultSets)
+	}
+
+	log := fakeLog(source)
+	call := log[len(log)-1]
+	if !strings.Contains(call, "@kdbp1 AS [y]") || !strings.Contains(call, "@kdbp2 AS [sum]") {
+		t.Errorf("CallFunc statement error; actual=[%v]", call)
+	}
+}
+
+func TestCallFuncMysql(t *testing.T) {
+	db, source := newFakeDB(t, "fakemysql")
+	defer db.Close()
+
+	fakeResult(source, "information_schema.ROUTINES", []string{"catalog", "schema", "name"},
+		[]driver.Value{"def", "demo", "sp_inout"})
+	fakeResult(source, "information_schema.PARAMETERS", []string{"name", "position", "dirmode", "datatype", "length", "precision", "scale"},
+		[]driver.Value{"x", int64(1), "IN", "int", int64(0), int64(10), int64(0)},
+		[]driver.Value{"y", int64(2), "INOUT", "int", int64(0), int64(10), int64(0)})
+	fakeResult(source, "CALL sp_inout", []string{"cint"}, []driver.Value{int64(42)})
+	fakeResult(source, "SELECT @y", []string{"y"}, []driver.Value{int64(3)})
+
+	result, err := db.CallFunc("sp_inout", Map{"x": 1, "y": 2})
+	if err != nil {
+		t.Fatal("CallFunc error", err)
+	}
+
+	if v, _ := result.Get("y"); v != int64(3) {
+		t.Errorf("CallFunc inout parameter error; actual=[%v]", v)
+	}
+	if len(result.ResultSets) != 1 || len(result.ResultSets[0]) != 1 || result.ResultSets[0][0]["cint"] != int64(42) {
+		t.Errorf("CallFunc result sets error; actual=[%v]", result.ResultSets)
+	}
+
+	log := fakeLog(source)
+	assertLog(t, source, log[0], log[1], "SET @y = ?", "CALL sp_inout ( ?, @y )", "SELECT @y AS y")
+}
+
+func TestCallFuncPostgres(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	fakeResult(source, `as "name" from information_schema.routines`, []string{"catalog", "schema", "name"},
+		[]driver.Value{"demo", "public", "fn_split"})
+	fakeResult(source, "information_schema.parameters p", []string{"name", "position", "dirmode", "datatype", "length", "precision", "scale"},
+		[]driver.Value{"x", int64(1), "IN", "int", int64(0), int64(10), int64(0)},
+		[]driver.Value{"y", int64(2), "OUT", "int", int64(0), int64(10), int64(0)})
+	fakeResult(source, "FROM fn_split", []string{"y"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}, []driver.Value{int64(3)})
+
+	result, err := db.CallFunc("fn_split", Map{"x": 3})
+	if err != nil {
+		t.Fatal("CallFunc error", err)
+	}
+	if len(result.ResultSets) != 1 || len(result.ResultSets[0]) != 3 || result.ResultSets[0][2]["y"] != int64(3) {
+		t.Errorf("CallFunc should keep rows of set returning function; actual=[%v]", result.ResultSets)
+	}
+	if v, _ := result.Get("y"); v != nil {
+		t.Errorf("CallFunc out parameter of set returning function error; actual=[%v]", v)
+	}
+
+	fakeResult(source, "FROM fn_split", []string{"y"}, []driver.Value{int64(5)})
+	if result, err = db.CallFunc("fn_split", Map{"x": 3}); err != nil {
+		t.Fatal("CallFunc error", err)
+	}
+	if v, _ := result.Get("y"); v != int64(5) || len(result.ResultSets) != 0 {
+		t.Errorf("CallFunc out parameter error; actual=[%v]; result sets=[%v]", v, result.ResultSets)
+	}
+}
+
+func TestCompileMysqlProcedure(t *testing.T) {
+	sp := NewProcedure("fn_calc")
+	sp.Parameter(&Parameter{Name: "ret", Dir: ansi.DirReturn})
+	sp.Parameter(&Parameter{Name: "x", Value: 1, Dir: ansi.DirIn})
+	sp.Parameter(&Parameter{Name: "y", Value: 2, Dir: ansi.DirInOut})
+	sp.Parameter(&Parameter{Name: "sum", Dir: ansi.DirOut})
+
+	query, args, err := NewSqlDriver(MysqlDialecter{}).Compile("source", sp)
+	want := "SET @y = ?; \nSET @ret = fn_calc ( ?, @y, @sum );\nSELECT @ret AS ret, @y AS y, @sum AS sum; "
+	if err != nil || query != want || !reflect.DeepEqual(args, []interface{}{2, 1}) {
+		t.Errorf("compiled mysql procedure error; want=[%q]; actual=[%q]; args=[%v]; err=[%v]", want, query, args, err)
+	}
+}
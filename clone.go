@@ -0,0 +1,457 @@
+package kdb
+
+import (
+	"reflect"
+)
+
+// cloneExp return deep copy of expression, unknown expression types are shared
+func cloneExp(exp Expression) Expression {
+	if isNilExpression(exp) {
+		return exp
+	}
+
+	switch e := exp.(type) {
+	case *Column:
+		c := *e
+		return &c
+	case *Value:
+		return &Value{Value: cloneValue(e.Value)}
+	case *Parameter:
+		return e.clone()
+	case *Set:
+		return e.clone()
+	case *Condition:
+		return &Condition{Left: cloneExp(e.Left), Op: e.Op, Right: cloneExp(e.Right), High: cloneExp(e.High), Escape: e.Escape}
+	case *Aggregate:
+		return NewAggregate(e.Name, cloneExp(e.Exp))
+	case *Call:
+		return &Call{Name: e.Name, Args: cloneExps(e.Args)}
+	case *Case:
+		return e.clone()
+	case *Window:
+		return e.clone()
+	case *Where:
+		return e.Clone()
+	case *Having:
+		return e.clone()
+	case *GroupBy:
+		return e.clone()
+	case *Table:
+		return e.clone()
+	case *Select:
+		return e.clone()
+	case *OrderBy:
+		return e.clone()
+	case *From:
+		return e.Clone()
+	case *Join:
+		return e.Clone()
+	case *Output:
+		return e.clone()
+	case *With:
+		return e.clone()
+	case *Lock:
+		return e.clone()
+	case *Text:
+		return &Text{Sql: e.Sql, Parameters: cloneParameters(e.Parameters)}
+	case *Procedure:
+		return &Procedure{Name: e.Name, Parameters: cloneParameters(e.Parameters)}
+	case *Insert:
+		return e.Clone()
+	case *Upsert:
+		return e.clone()
+	case *Update:
+		return e.Clone()
+	case *Delete:
+		return e.Clone()
+	case *Query:
+		return e.Clone()
+	case *Compound:
+		return e.clone()
+	}
+
+	// Null, Sql, Column, Operator, Func and unknown types
+	return exp
+}
+
+// cloneExps return deep copy of expressions
+func cloneExps(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	c := make([]Expression, len(list))
+	for i := 0; i < len(list); i++ {
+		c[i] = cloneExp(list[i])
+	}
+	return c
+}
+
+// cloneValue return copy of value, slices, arrays and maps are copied deeply, pointers are shared
+func cloneValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return cloneReflectValue(rv).Interface()
+	}
+	return v
+}
+
+func cloneReflectValue(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			c.Index(i).Set(cloneReflectValue(rv.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			c.Index(i).Set(cloneReflectValue(rv.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), cloneReflectValue(iter.Value()))
+		}
+		return c
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.New(rv.Type()).Elem()
+		c.Set(cloneReflectValue(rv.Elem()))
+		return c
+	}
+	return rv
+}
+
+func cloneParameters(ps []*Parameter) []*Parameter {
+	if ps == nil {
+		return nil
+	}
+	c := make([]*Parameter, len(ps))
+	for i := 0; i < len(ps); i++ {
+		c[i] = ps[i].clone()
+	}
+	return c
+}
+
+func cloneSets(sets []*Set) []*Set {
+	if sets == nil {
+		return nil
+	}
+	c := make([]*Set, len(sets))
+	for i := 0; i < len(sets); i++ {
+		c[i] = sets[i].clone()
+	}
+	return c
+}
+
+func cloneColumns(columns []Column) []Column {
+	if columns == nil {
+		return nil
+	}
+	return append(make([]Column, 0, len(columns)), columns...)
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func (p *Parameter) clone() *Parameter {
+	if p == nil {
+		return nil
+	}
+	return &Parameter{Name: p.Name, Value: cloneValue(p.Value), Dir: p.Dir}
+}
+
+func (a *Set) clone() *Set {
+	if a == nil {
+		return nil
+	}
+	return &Set{Column: a.Column, Value: cloneExp(a.Value)}
+}
+
+// Clone return deep copy of conditions
+func (c *Conditions) Clone() *Conditions {
+	if c == nil {
+		return nil
+	}
+	return &Conditions{Conditions: cloneExps(c.Conditions), needLogicOperator: c.needLogicOperator}
+}
+
+func (c *Case) clone() *Case {
+	if c == nil {
+		return nil
+	}
+	cs := &Case{Exp: cloneExp(c.Exp), Else: cloneExp(c.Else)}
+	if c.Whens != nil {
+		cs.Whens = make([]*CaseWhen, len(c.Whens))
+		for i := 0; i < len(c.Whens); i++ {
+			w := c.Whens[i]
+			cs.Whens[i] = &CaseWhen{Value: cloneExp(w.Value), Conditions: w.Conditions.Clone(), Result: cloneExp(w.Result)}
+		}
+	}
+	return cs
+}
+
+func (w *Window) clone() *Window {
+	if w == nil {
+		return nil
+	}
+	c := &Window{Func: cloneExp(w.Func), PartitionBy: cloneExps(w.PartitionBy), OrderBy: w.OrderBy.clone()}
+	if w.Frame != nil {
+		f := *w.Frame
+		c.Frame = &f
+	}
+	return c
+}
+
+// Clone return deep copy of where
+func (w *Where) Clone() *Where {
+	if w == nil {
+		return nil
+	}
+	return &Where{w.Conditions.Clone()}
+}
+
+func (h *Having) clone() *Having {
+	if h == nil {
+		return nil
+	}
+	return &Having{h.Conditions.Clone()}
+}
+
+func (g *GroupBy) clone() *GroupBy {
+	if g == nil {
+		return nil
+	}
+	return &GroupBy{Fields: cloneExps(g.Fields)}
+}
+
+func (t *Table) clone() *Table {
+	if t == nil {
+		return nil
+	}
+	return &Table{Name: t.Name, Alias: t.Alias, Query: t.Query.Clone()}
+}
+
+func (s *Select) clone() *Select {
+	if s == nil {
+		return nil
+	}
+	c := &Select{}
+	if s.Fields != nil {
+		c.Fields = make([]*Field, len(s.Fields))
+		for i := 0; i < len(s.Fields); i++ {
+			c.Fields[i] = &Field{Exp: cloneExp(s.Fields[i].Exp), Alias: s.Fields[i].Alias}
+		}
+	}
+	return c
+}
+
+func (od *OrderBy) clone() *OrderBy {
+	if od == nil {
+		return nil
+	}
+	c := &OrderBy{}
+	if od.Fields != nil {
+		c.Fields = make([]*OrderByField, len(od.Fields))
+		for i := 0; i < len(od.Fields); i++ {
+			c.Fields[i] = &OrderByField{Exp: cloneExp(od.Fields[i].Exp), Direction: od.Fields[i].Direction}
+		}
+	}
+	return c
+}
+
+// Clone return deep copy of from, tables shared by joins are still shared in copy
+func (f *From) Clone() *From {
+	if f == nil {
+		return nil
+	}
+
+	tables := make(map[*Table]*Table)
+	c := &From{Table: cloneTableOnce(tables, f.Table)}
+	if f.Tables != nil {
+		c.Tables = make([]*Table, len(f.Tables))
+		for i := 0; i < len(f.Tables); i++ {
+			c.Tables[i] = cloneTableOnce(tables, f.Tables[i])
+		}
+	}
+	if f.Joins != nil {
+		c.Joins = make([]*Join, len(f.Joins))
+		for i := 0; i < len(f.Joins); i++ {
+			c.Joins[i] = f.Joins[i].cloneWith(tables)
+		}
+	}
+	return c
+}
+
+// cloneTableOnce return copy of table, same table is copied only once
+func cloneTableOnce(tables map[*Table]*Table, t *Table) *Table {
+	if t == nil {
+		return nil
+	}
+	if c, ok := tables[t]; ok {
+		return c
+	}
+	c := t.clone()
+	tables[t] = c
+	return c
+}
+
+// Clone return deep copy of join
+func (j *Join) Clone() *Join {
+	return j.cloneWith(make(map[*Table]*Table))
+}
+
+func (j *Join) cloneWith(tables map[*Table]*Table) *Join {
+	if j == nil {
+		return nil
+	}
+	return &Join{
+		JoinType:   j.JoinType,
+		Left:       cloneTableOnce(tables, j.Left),
+		Right:      cloneTableOnce(tables, j.Right),
+		Conditions: j.Conditions.Clone(),
+	}
+}
+
+func (o *Output) clone() *Output {
+	if o == nil {
+		return nil
+	}
+	return &Output{Columns: cloneColumns(o.Columns)}
+}
+
+func (w *With) clone() *With {
+	if w == nil {
+		return nil
+	}
+	c := &With{Recursive: w.Recursive}
+	if w.Tables != nil {
+		c.Tables = make([]*CommonTable, len(w.Tables))
+		for i := 0; i < len(w.Tables); i++ {
+			ct := w.Tables[i]
+			c.Tables[i] = &CommonTable{Name: ct.Name, Columns: cloneStrings(ct.Columns), Query: cloneExp(ct.Query)}
+		}
+	}
+	return c
+}
+
+func (l *Lock) clone() *Lock {
+	if l == nil {
+		return nil
+	}
+	return &Lock{Mode: l.Mode, Wait: l.Wait, Of: cloneStrings(l.Of)}
+}
+
+// Clone return deep copy of insert
+func (ist *Insert) Clone() *Insert {
+	if ist == nil {
+		return nil
+	}
+	c := &Insert{
+		Table:   ist.Table.clone(),
+		Sets:    cloneSets(ist.Sets),
+		Query:   cloneExp(ist.Query),
+		Columns: cloneColumns(ist.Columns),
+		Output:  ist.Output.clone(),
+	}
+	if ist.Rows != nil {
+		c.Rows = make([][]Expression, len(ist.Rows))
+		for i := 0; i < len(ist.Rows); i++ {
+			c.Rows[i] = cloneExps(ist.Rows[i])
+		}
+	}
+	return c
+}
+
+func (u *Upsert) clone() *Upsert {
+	if u == nil {
+		return nil
+	}
+	return &Upsert{Table: u.Table.clone(), Sets: cloneSets(u.Sets), Keys: cloneColumns(u.Keys)}
+}
+
+// Clone return deep copy of update
+func (u *Update) Clone() *Update {
+	if u == nil {
+		return nil
+	}
+	return &Update{
+		Table:   u.Table.clone(),
+		Sets:    cloneSets(u.Sets),
+		Where:   u.Where.Clone(),
+		OrderBy: u.OrderBy.clone(),
+		Count:   u.Count,
+		Output:  u.Output.clone(),
+		With:    u.With.clone(),
+		From:    u.From.Clone(),
+	}
+}
+
+// Clone return deep copy of delete
+func (d *Delete) Clone() *Delete {
+	if d == nil {
+		return nil
+	}
+	return &Delete{
+		Table:   d.Table.clone(),
+		From:    d.From.Clone(),
+		Where:   d.Where.Clone(),
+		OrderBy: d.OrderBy.clone(),
+		Count:   d.Count,
+		Output:  d.Output.clone(),
+		With:    d.With.clone(),
+	}
+}
+
+// Clone return deep copy of query, like a base query to derive count and page queries from
+func (q *Query) Clone() *Query {
+	if q == nil {
+		return nil
+	}
+	return &Query{
+		Select:     q.Select.clone(),
+		From:       q.From.Clone(),
+		Where:      q.Where.Clone(),
+		GroupBy:    q.GroupBy.clone(),
+		Having:     q.Having.clone(),
+		OrderBy:    q.OrderBy.clone(),
+		IsDistinct: q.IsDistinct,
+		Offset:     q.Offset,
+		Count:      q.Count,
+		With:       q.With.clone(),
+		Lock:       q.Lock.clone(),
+	}
+}
+
+func (c *Compound) clone() *Compound {
+	if c == nil {
+		return nil
+	}
+	cp := &Compound{Query: c.Query.Clone(), OrderBy: c.OrderBy.clone(), Offset: c.Offset, Count: c.Count, With: c.With.clone()}
+	if c.Queries != nil {
+		cp.Queries = make([]*CompoundQuery, len(c.Queries))
+		for i := 0; i < len(c.Queries); i++ {
+			cp.Queries[i] = &CompoundQuery{Operator: c.Queries[i].Operator, Query: c.Queries[i].Query.Clone()}
+		}
+	}
+	return cp
+}
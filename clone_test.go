@@ -0,0 +1,86 @@
+package kdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	ids := []int{1, 2}
+	base := NewQuery("person", "p")
+	base.Select.Column("p.id", "p.name")
+	base.From.LeftJoin("city", "c").On("p.city", "c.id")
+	base.Where.In("p.id", ids).Equals("c.name", "x")
+	base.UseOrderBy().Asc("p.name")
+
+	driver := NewSqlDriver(PostgreSQLDialecter{})
+	want, wantArgs, err := driver.Compile("source", base)
+	if err != nil {
+		t.Fatal("compile base query error", err)
+	}
+
+	page := base.Clone()
+	if !reflect.DeepEqual(page, base) {
+		t.Error("clone query isn't equal to original")
+	}
+	page.Where.GreaterThan("p.age", 18)
+	page.UseOrderBy().Desc("p.id")
+	page.Select.Column("p.age")
+	page.Limit(10, 20)
+	page.From.Joins[0].On("p.country", "c.country")
+	page.Where.Conditions.Conditions[0].(*Condition).Right.(*Value).Value.([]int)[0] = 100
+
+	count := base.Clone()
+	count.Select = NewSelect().Count("*", "cnt")
+	count.OrderBy = nil
+	if count.From.Joins[0].Left != count.From.Table {
+		t.Error("clone from should keep table shared by join")
+	}
+
+	query, args, _ := driver.Compile("source", base)
+	if query != want || !reflect.DeepEqual(args, wantArgs) {
+		t.Error("base query is changed by clone", "\n", query, "\n", want, args)
+	}
+	if ids[0] != 1 {
+		t.Error("value of base query is changed by clone")
+	}
+
+	query, _, _ = driver.Compile("source", count)
+	if want := `SELECT COUNT(*) AS "cnt" FROM person AS p LEFT JOIN city AS c ON p.city = c.id WHERE p.id IN (1, 2) AND c.name = $1;`; removeSpace(query) != removeSpace(want) {
+		t.Error("compile cloned query error", "\n", query, "\n", want)
+	}
+
+	u := NewUpdate("person").Set("name", "a")
+	u.Where.Equals("id", 1)
+	uc := u.Clone()
+	uc.Set("age", 2).Where.Equals("name", "b")
+	if len(u.Sets) != 1 || len(u.Where.Conditions.Conditions) != 1 {
+		t.Error("update is changed by clone", u)
+	}
+
+	d := NewDelete("person")
+	d.Where.Equals("id", 1)
+	dc := d.Clone()
+	dc.Where.Equals("name", "b")
+	if len(d.Where.Conditions.Conditions) != 1 {
+		t.Error("delete is changed by clone", d)
+	}
+
+	ist := NewInsert("person").Set("name", "a").Row("b")
+	ic := ist.Clone()
+	ic.Rows[0][0] = &Value{Value: "c"}
+	ic.Set("age", 1)
+	if len(ist.Sets) != 1 || ist.Rows[0][0].(*Value).Value != "b" {
+		t.Error("insert is changed by clone", ist)
+	}
+
+	c := NewConditions().Equals("a", 1)
+	cc := c.Clone().Equals("b", 2)
+	if len(c.Conditions) != 1 || len(cc.Conditions) != 3 {
+		t.Error("conditions clone error", c, cc)
+	}
+
+	if (*Query)(nil).Clone() != nil || (*Where)(nil).Clone() != nil {
+		t.Error("clone nil should return nil")
+	}
+}
@@ -3,6 +3,7 @@ package kdb
 import (
 	"fmt"
 	"github.com/sdming/kdb/ansi"
+	"strings"
 )
 
 const nilStr string = "<nil>"
@@ -199,6 +200,18 @@ type Insert struct {
 
 	// Sets is set[column=value]
 	Sets []*Set
+
+	// Rows is more rows to insert, values of each row are in same order as Sets
+	Rows [][]Expression
+
+	// Query is *Query or *Compound to insert rows from, Sets and Rows should be empty if Query isn't nil
+	Query Expression
+
+	// Columns is columns to insert from Query, empty means all columns of table
+	Columns []Column
+
+	// Output is returned columns
+	Output *Output
 }
 
 // String
@@ -207,7 +220,7 @@ func (ist *Insert) String() string {
 		return nilStr
 	}
 
-	return fmt.Sprint(ansi.Insert, " ", ist.Table, " ", ist.Sets)
+	return fmt.Sprint(ansi.Insert, " ", ist.Table, " ", ist.Sets, " ", ist.Rows, "\n", ist.Columns, " ", ist.Query, "\n", ist.Output)
 }
 
 // Node return NodeInsert
@@ -232,11 +245,123 @@ func (ist *Insert) Append(a *Set) {
 	ist.Sets = append(ist.Sets, a)
 }
 
+// Row append a row of values, values are in same order as Sets
+func (ist *Insert) Row(values ...interface{}) *Insert {
+	row := make([]Expression, len(values))
+	for i := 0; i < len(values); i++ {
+		row[i] = asExpression(values[i])
+	}
+	ist.Rows = append(ist.Rows, row)
+	return ist
+}
+
+// Select set query to insert rows from, columns are columns of table in same order as fields of query
+func (ist *Insert) Select(query Expression, columns ...string) *Insert {
+	ist.Query = query
+	ist.Columns = make([]Column, 0, len(columns))
+	for i := 0; i < len(columns); i++ {
+		ist.Columns = append(ist.Columns, Column(columns[i]))
+	}
+	return ist
+}
+
+// Returning set columns returned by insert
+func (ist *Insert) Returning(columns ...string) *Insert {
+	ist.Output = NewOutput(columns...)
+	return ist
+}
+
 // NewInsert return *Insert with provided table
 func NewInsert(table string) *Insert {
 	return &Insert{Table: newTable(table, ""), Sets: make([]*Set, 0, _defaultCapicity)}
 }
 
+// Upsert is sql "insert or update" clause, update row if keys conflict else insert
+type Upsert struct {
+	// Table is table to insert or update
+	Table *Table
+
+	// Sets is set[column=value]
+	Sets []*Set
+
+	// Keys is conflict columns, row is updated if values of keys exist
+	Keys []Column
+}
+
+// String
+func (u *Upsert) String() string {
+	if u == nil {
+		return nilStr
+	}
+
+	return fmt.Sprint("UPSERT", " ", u.Table, " ", u.Sets, " ", u.Keys)
+}
+
+// Node return NodeUpsert
+func (u *Upsert) Node() NodeType {
+	return NodeUpsert
+}
+
+// Set is shortcut of Append
+func (u *Upsert) Set(column string, value interface{}) *Upsert {
+	u.Append(newSet(column, asExpression(value)))
+	return u
+}
+
+// Append Append an *Set
+func (u *Upsert) Append(a *Set) {
+	if a == nil {
+		return
+	}
+	if u.Sets == nil {
+		u.Sets = make([]*Set, 0, _defaultCapicity)
+	}
+	u.Sets = append(u.Sets, a)
+}
+
+// Key append conflict columns
+func (u *Upsert) Key(columns ...string) *Upsert {
+	for i := 0; i < len(columns); i++ {
+		u.Keys = append(u.Keys, Column(columns[i]))
+	}
+	return u
+}
+
+func (u *Upsert) isKey(c Column) bool {
+	for i := 0; i < len(u.Keys); i++ {
+		if strings.EqualFold(u.Keys[i].String(), c.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *Upsert) hasColumn(c Column) bool {
+	for i := 0; i < len(u.Sets); i++ {
+		if strings.EqualFold(u.Sets[i].Column.String(), c.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateColumns return columns of sets that aren't keys
+func (u *Upsert) updateColumns() []Column {
+	cols := make([]Column, 0, len(u.Sets))
+	for i := 0; i < len(u.Sets); i++ {
+		if !u.isKey(u.Sets[i].Column) {
+			cols = append(cols, u.Sets[i].Column)
+		}
+	}
+	return cols
+}
+
+// NewUpsert return *Upsert with provided table and conflict columns
+func NewUpsert(table string, keys ...string) *Upsert {
+	u := &Upsert{Table: newTable(table, ""), Sets: make([]*Set, 0, _defaultCapicity)}
+	return u.Key(keys...)
+}
+
 // Update is sql update clause
 type Update struct {
 	//T able is table to update
@@ -254,7 +379,14 @@ type Update struct {
 	// Count is limit count
 	Count int
 
-	//Output      *Output
+	// Output is returned columns
+	Output *Output
+
+	// With is with clause, oracle doesn't support with clause on update
+	With *With
+
+	// From is other tables joined to Table, join conditions to Table are in Where
+	From *From
 }
 
 // String
@@ -262,7 +394,7 @@ func (u *Update) String() string {
 	if u == nil {
 		return nilStr
 	}
-	return fmt.Sprint(ansi.Update, " ", u.Table, " ", ansi.Set, " ", u.Sets, "\n", u.Where, "\n", u.OrderBy, "\n", ansi.Limit, u.Count)
+	return fmt.Sprint(u.With, "\n", ansi.Update, " ", u.Table, " ", ansi.Set, " ", u.Sets, "\n", u.From, "\n", u.Where, "\n", u.OrderBy, "\n", ansi.Limit, u.Count, "\n", u.Output)
 }
 
 // Node return NodeUpdate
@@ -290,11 +422,31 @@ func (u *Update) Limit(count int) *Update {
 	return u
 }
 
-// NotImplemented
-// func (u *Update) Output(sql string) *Update {
-// 	u.Output = newOutput(sql)
-// 	return u
-// }
+// Returning set columns returned by update, value of column is new value
+func (u *Update) Returning(columns ...string) *Update {
+	u.Output = NewOutput(columns...)
+	return u
+}
+
+// As set alias of updated table
+func (u *Update) As(alias string) *Update {
+	u.Table.Alias = alias
+	return u
+}
+
+// UseFrom new a *From of other tables joined to updated table and set to u.From
+func (u *Update) UseFrom(table, alias string) *From {
+	u.From = NewFrom(table, alias)
+	return u.From
+}
+
+// UseWith initialize u.With then return it
+func (u *Update) UseWith() *With {
+	if u.With == nil {
+		u.With = NewWith()
+	}
+	return u.With
+}
 
 func NewUpdate(table string) *Update {
 	return &Update{
@@ -310,7 +462,7 @@ type Delete struct {
 	//Table is the table to delete
 	Table *Table
 
-	// From is from clause
+	// From is other tables joined to Table, join conditions to Table are in Where
 	From *From
 
 	// Where is where clause
@@ -322,7 +474,11 @@ type Delete struct {
 	// Count is limit count
 	Count int
 
-	//Output  *Output
+	// Output is returned columns
+	Output *Output
+
+	// With is with clause, oracle doesn't support with clause on delete
+	With *With
 }
 
 // String
@@ -330,7 +486,7 @@ func (d *Delete) String() string {
 	if d == nil {
 		return nilStr
 	}
-	return fmt.Sprint(ansi.Delete, " ", d.Table, "\n", d.From, "\n", d.Where, "\n", d.OrderBy, "\n", ansi.Limit, d.Count)
+	return fmt.Sprint(d.With, "\n", ansi.Delete, " ", d.Table, "\n", d.From, "\n", d.Where, "\n", d.OrderBy, "\n", ansi.Limit, d.Count, "\n", d.Output)
 
 }
 
@@ -345,7 +501,13 @@ func (d *Delete) Limit(count int) *Delete {
 	return d
 }
 
-// UseFrom new a *From and set to d.From
+// As set alias of deleted table
+func (d *Delete) As(alias string) *Delete {
+	d.Table.Alias = alias
+	return d
+}
+
+// UseFrom new a *From of other tables joined to deleted table and set to d.From
 func (d *Delete) UseFrom(table, alias string) *From {
 	d.From = NewFrom(table, alias)
 	return d.From
@@ -357,11 +519,19 @@ func (d *Delete) UseOrderBy() *OrderBy {
 	return d.OrderBy
 }
 
-// NotImplemented
-// func (d *Delete) Output(sql string) *Delete {
-// 	d.Output = newOutput(sql)
-// 	return d
-// }
+// UseWith initialize d.With then return it
+func (d *Delete) UseWith() *With {
+	if d.With == nil {
+		d.With = NewWith()
+	}
+	return d.With
+}
+
+// Returning set columns returned by delete
+func (d *Delete) Returning(columns ...string) *Delete {
+	d.Output = NewOutput(columns...)
+	return d
+}
 
 // NewDelete return a *Delete with provided table
 func NewDelete(table string) *Delete {
@@ -383,6 +553,8 @@ type Query struct {
 	IsDistinct bool
 	Offset     int
 	Count      int
+	With       *With
+	Lock       *Lock
 }
 
 // String
@@ -394,7 +566,7 @@ func (q *Query) String() string {
 	if q.IsDistinct {
 		distinct = ansi.Distinct
 	}
-	return fmt.Sprint(ansi.Select, " ", distinct, " ", q.Select, "\n", q.From, "\n", q.Where, q.GroupBy, "\n", q.Having, "\n", q.OrderBy, "\n", ansi.Limit, q.Offset, q.Count)
+	return fmt.Sprint(q.With, "\n", ansi.Select, " ", distinct, " ", q.Select, "\n", q.From, "\n", q.Where, q.GroupBy, "\n", q.Having, "\n", q.OrderBy, "\n", ansi.Limit, q.Offset, q.Count, "\n", q.Lock)
 }
 
 // Node return NodeQuery
@@ -402,7 +574,7 @@ func (q *Query) Node() NodeType {
 	return NodeQuery
 }
 
-// Limit set offset and count
+// Limit set offset and count, count <= 0 means no limit; compiled to dialect paging syntax
 func (q *Query) Limit(offset, count int) *Query {
 	q.Offset = offset
 	q.Count = count
@@ -439,6 +611,91 @@ func (q *Query) UseOrderBy() *OrderBy {
 	return q.OrderBy
 }
 
+// UseWith initialize q.With then return it
+func (q *Query) UseWith() *With {
+	if q.With == nil {
+		q.With = NewWith()
+	}
+	return q.With
+}
+
+// ForUpdate lock selected rows for update, of is tables to lock, empty means all tables
+func (q *Query) ForUpdate(wait LockWait, of ...string) *Query {
+	q.Lock = &Lock{Mode: ForUpdate, Wait: wait, Of: of}
+	return q
+}
+
+// ForShare lock selected rows in share mode, of is tables to lock, empty means all tables
+func (q *Query) ForShare(wait LockWait, of ...string) *Query {
+	q.Lock = &Lock{Mode: ForShare, Wait: wait, Of: of}
+	return q
+}
+
+// LockMode is mode of row lock
+type LockMode string
+
+// String
+func (m LockMode) String() string {
+	return string(m)
+}
+
+const (
+	ForUpdate LockMode = ansi.ForUpdate
+	ForShare  LockMode = ansi.ForShare
+)
+
+// LockWait is behavior when rows are locked by other transaction
+type LockWait string
+
+// String
+func (w LockWait) String() string {
+	return string(w)
+}
+
+const (
+	Wait       LockWait = ""
+	NoWait     LockWait = ansi.NoWait
+	SkipLocked LockWait = ansi.SkipLocked
+)
+
+// Lock is row locking clause of query, compiled to FOR UPDATE/FOR SHARE or table hints on sql server
+type Lock struct {
+	Mode LockMode
+	Wait LockWait
+
+	// Of is names or aliases of tables to lock, oracle doesn't support it
+	Of []string
+}
+
+// String
+func (l *Lock) String() string {
+	if l == nil {
+		return nilStr
+	}
+	return fmt.Sprint(l.Mode, " ", ansi.Of, " ", l.Of, " ", l.Wait)
+}
+
+// Node return NodeLock
+func (l *Lock) Node() NodeType {
+	return NodeLock
+}
+
+// locks return true if table should be locked
+func (l *Lock) locks(t *Table) bool {
+	if t == nil || t.Query != nil {
+		return false
+	}
+	if len(l.Of) == 0 {
+		return true
+	}
+	for i := 0; i < len(l.Of); i++ {
+		if strings.EqualFold(l.Of[i], t.Name) || (t.Alias != "" && strings.EqualFold(l.Of[i], t.Alias)) {
+			return true
+		}
+	}
+	return false
+}
+
 // NewQuery return  *Query
 func NewQuery(table, alias string) *Query {
 	return &Query{
@@ -447,3 +704,124 @@ func NewQuery(table, alias string) *Query {
 		Select: NewSelect(),
 	}
 }
+
+// NewQueryFrom return *Query that select from sub query
+func NewQueryFrom(query *Query, alias string) *Query {
+	return &Query{
+		From:   NewFromQuery(query, alias),
+		Where:  NewWhere(),
+		Select: NewSelect(),
+	}
+}
+
+// SetOperator is operator of compound query
+type SetOperator string
+
+// String
+func (op SetOperator) String() string {
+	return string(op)
+}
+
+const (
+	Union     SetOperator = ansi.Union
+	UnionAll  SetOperator = ansi.UnionAll
+	Intersect SetOperator = ansi.Intersect
+	Except    SetOperator = ansi.Except
+)
+
+// CompoundQuery is a query combined to previous queries by Operator
+type CompoundQuery struct {
+	Operator SetOperator
+	Query    *Query
+}
+
+// Compound is queries combined by UNION, UNION ALL, INTERSECT or EXCEPT
+type Compound struct {
+	// Query is the first query
+	Query *Query
+
+	// Queries is queries combined to the first query in order
+	Queries []*CompoundQuery
+
+	// OrderBy, Offset and Count apply to result of compound query
+	OrderBy *OrderBy
+	Offset  int
+	Count   int
+
+	// With is with clause of compound query
+	With *With
+}
+
+// String
+func (c *Compound) String() string {
+	if c == nil {
+		return nilStr
+	}
+	s := fmt.Sprint(c.With, "\n", c.Query)
+	for i := 0; i < len(c.Queries); i++ {
+		s += fmt.Sprint("\n", c.Queries[i].Operator, "\n", c.Queries[i].Query)
+	}
+	return fmt.Sprint(s, "\n", c.OrderBy, "\n", ansi.Limit, c.Offset, c.Count)
+}
+
+// Node return NodeCompound
+func (c *Compound) Node() NodeType {
+	return NodeCompound
+}
+
+// Combine append a query by operator
+func (c *Compound) Combine(op SetOperator, query *Query) *Compound {
+	c.Queries = append(c.Queries, &CompoundQuery{Operator: op, Query: query})
+	return c
+}
+
+// Union append a query by UNION
+func (c *Compound) Union(query *Query) *Compound {
+	return c.Combine(Union, query)
+}
+
+// UnionAll append a query by UNION ALL
+func (c *Compound) UnionAll(query *Query) *Compound {
+	return c.Combine(UnionAll, query)
+}
+
+// Intersect append a query by INTERSECT
+func (c *Compound) Intersect(query *Query) *Compound {
+	return c.Combine(Intersect, query)
+}
+
+// Except append a query by EXCEPT, compiled to MINUS on oracle
+func (c *Compound) Except(query *Query) *Compound {
+	return c.Combine(Except, query)
+}
+
+// Limit set offset and count, count <= 0 means no limit; compiled to dialect paging syntax
+func (c *Compound) Limit(offset, count int) *Compound {
+	c.Offset = offset
+	c.Count = count
+	return c
+}
+
+// UseOrderBy initialize c.OrderBy then return it
+func (c *Compound) UseOrderBy() *OrderBy {
+	if c.OrderBy == nil {
+		c.OrderBy = NewOrderBy()
+	}
+	return c.OrderBy
+}
+
+// UseWith initialize c.With then return it
+func (c *Compound) UseWith() *With {
+	if c.With == nil {
+		c.With = NewWith()
+	}
+	return c.With
+}
+
+// NewCompound return *Compound with the first query
+func NewCompound(query *Query) *Compound {
+	return &Compound{
+		Query:   query,
+		Queries: make([]*CompoundQuery, 0, _defaultCapicity),
+	}
+}
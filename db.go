@@ -1,10 +1,12 @@
 package kdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/sdming/kdb/ansi"
+	"reflect"
 	"strings"
 	"sync"
 )
@@ -22,7 +24,11 @@ const (
 
 // DB is wrap of *sql.DB
 type DB struct {
-	DSN     *DSN
+	DSN *DSN
+
+	// NameMapper map struct field names to column names, DefaultNameMapper is used if it's nil
+	NameMapper *NameMapper
+
 	innerdb *sql.DB
 	state   state
 }
@@ -87,6 +93,22 @@ func (db *DB) Close() error {
 	return nil
 }
 
+// nameMapper return NameMapper of db, or DefaultNameMapper
+func (db *DB) nameMapper() *NameMapper {
+	if db.NameMapper != nil {
+		return db.NameMapper
+	}
+	return DefaultNameMapper
+}
+
+// entity rewrap data by NameMapper of db if data is *GEntity created by Entity
+func (db *DB) entity(data Getter) Getter {
+	if e, ok := data.(*GEntity); ok && e.mapper == nil && db.NameMapper != nil {
+		return EntityWith(db.NameMapper, e.Data, e.filters...)
+	}
+	return data
+}
+
 func (db *DB) dialecter() (dialect Dialecter, err error) {
 	if db.DSN == nil || db.DSN.Driver == "" || db.DSN.Source == "" {
 		err = errors.New("DB dsn is invalid")
@@ -101,6 +123,11 @@ func (db *DB) dialecter() (dialect Dialecter, err error) {
 
 // Function return schema of store procedure
 func (db *DB) Function(name string) (fn *ansi.DbFunction, err error) {
+	return db.FunctionContext(context.Background(), name)
+}
+
+// FunctionContext return schema of store procedure
+func (db *DB) FunctionContext(ctx context.Context, name string) (fn *ansi.DbFunction, err error) {
 	if err := db.Open(); err != nil {
 		return nil, err
 	}
@@ -111,6 +138,9 @@ func (db *DB) Function(name string) (fn *ansi.DbFunction, err error) {
 	}
 	query := dialect.FunctionSql(name)
 	if query == "" {
+		if schm, ok := dialect.(ContextSchemaer); ok {
+			return schm.FunctionContext(ctx, db.innerdb, name)
+		}
 		if schm, ok := dialect.(Schemaer); ok {
 			return schm.Function(db.innerdb, name)
 		}
@@ -119,7 +149,7 @@ func (db *DB) Function(name string) (fn *ansi.DbFunction, err error) {
 	}
 
 	var rows *sql.Rows
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -147,7 +177,7 @@ func (db *DB) Function(name string) (fn *ansi.DbFunction, err error) {
 		err = errors.New("driver doesn't support function parameters schema:" + db.DSN.Driver)
 		return
 	}
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -182,6 +212,11 @@ func (db *DB) Function(name string) (fn *ansi.DbFunction, err error) {
 
 // Table return schema of table,view
 func (db *DB) Table(name string) (table *ansi.DbTable, err error) {
+	return db.TableContext(context.Background(), name)
+}
+
+// TableContext return schema of table,view
+func (db *DB) TableContext(ctx context.Context, name string) (table *ansi.DbTable, err error) {
 	if err := db.Open(); err != nil {
 		return nil, err
 	}
@@ -192,6 +227,9 @@ func (db *DB) Table(name string) (table *ansi.DbTable, err error) {
 	}
 	query := dialect.TableSql(name)
 	if query == "" {
+		if schm, ok := dialect.(ContextSchemaer); ok {
+			return schm.TableContext(ctx, db.innerdb, name)
+		}
 		if schm, ok := dialect.(Schemaer); ok {
 			return schm.Table(db.innerdb, name)
 		}
@@ -200,7 +238,7 @@ func (db *DB) Table(name string) (table *ansi.DbTable, err error) {
 	}
 
 	var rows *sql.Rows
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -228,7 +266,7 @@ func (db *DB) Table(name string) (table *ansi.DbTable, err error) {
 		err = errors.New("driver doesn't support columns schema:" + db.DSN.Driver)
 		return
 	}
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -259,10 +297,15 @@ func (db *DB) Table(name string) (table *ansi.DbTable, err error) {
 
 // Query executes a query that returns *sql.Rows
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query that returns *sql.Rows
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	if err := db.Open(); err != nil {
 		return nil, err
 	}
-	rows, err := db.innerdb.Query(query, args...)
+	rows, err := db.innerdb.QueryContext(ctx, query, args...)
 	if LogLevel >= LogDebug {
 		logDebug("DB query:", query, args, err)
 	}
@@ -272,11 +315,16 @@ func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 
 // Exec executes a query that return sql.Result
 func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query that return sql.Result
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	if err := db.Open(); err != nil {
 		return nil, err
 	}
 
-	result, err := db.innerdb.Exec(query, args...)
+	result, err := db.innerdb.ExecContext(ctx, query, args...)
 	if LogLevel >= LogDebug {
 		logDebug("DB exec:", query, args, result, err)
 	}
@@ -286,22 +334,32 @@ func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
 
 // QueryText query a sql text templete
 func (db *DB) QueryText(template string, args Getter) (*sql.Rows, error) {
+	return db.QueryTextContext(context.Background(), template, args)
+}
+
+// QueryTextContext query a sql text templete
+func (db *DB) QueryTextContext(ctx context.Context, template string, args Getter) (*sql.Rows, error) {
 	text, err := db.parseText(template, args)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.QueryExp(text)
+	return db.QueryExpContext(ctx, text)
 }
 
 // ExecText exec a sql text template
 func (db *DB) ExecText(query string, args Getter) (sql.Result, error) {
+	return db.ExecTextContext(context.Background(), query, args)
+}
+
+// ExecTextContext exec a sql text template
+func (db *DB) ExecTextContext(ctx context.Context, query string, args Getter) (sql.Result, error) {
 	text, err := db.parseText(query, args)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.ExecExp(text)
+	return db.ExecExpContext(ctx, text)
 }
 
 func (db *DB) parseText(query string, args Getter) (*Text, error) {
@@ -334,22 +392,32 @@ func (db *DB) parseText(query string, args Getter) (*Text, error) {
 
 // QueryExp query a expression
 func (db *DB) QueryExp(exp Expression) (*sql.Rows, error) {
+	return db.QueryExpContext(context.Background(), exp)
+}
+
+// QueryExpContext query a expression
+func (db *DB) QueryExpContext(ctx context.Context, exp Expression) (*sql.Rows, error) {
 	sql, args, err := db.Compile(exp)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.Query(sql, args...)
+	return db.QueryContext(ctx, sql, args...)
 }
 
 // ExecExp execute a expression
 func (db *DB) ExecExp(exp Expression) (sql.Result, error) {
+	return db.ExecExpContext(context.Background(), exp)
+}
+
+// ExecExpContext execute a expression
+func (db *DB) ExecExpContext(ctx context.Context, exp Expression) (sql.Result, error) {
 	sql, args, err := db.Compile(exp)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.Exec(sql, args...)
+	return db.ExecContext(ctx, sql, args...)
 }
 
 // Compile compile expression to native sql
@@ -364,11 +432,171 @@ func (db *DB) Compile(exp Expression) (sql string, args []interface{}, err error
 	if err != nil {
 		return
 	}
+	if db.DSN.QuoteIdentifier {
+		oc, ok := compiler.(OptionCompiler)
+		if !ok {
+			err = errors.New("compiler doesn't support quote identifier:" + db.DSN.Driver)
+			return
+		}
+		sql, args, err = oc.CompileWithOptions(db.DSN.Source, exp, CompileOptions{QuoteIdentifier: true})
+		return
+	}
 	sql, args, err = compiler.Compile(db.DSN.Source, exp)
 	return
 }
 
-func (db *DB) getFnSchema(name string) (fn *ansi.DbFunction, err error) {
+// ExecReturning execute insert, update or delete with Returning columns, then read returned rows to dest by Read
+func (db *DB) ExecReturning(exp Expression, dest interface{}) error {
+	return db.ExecReturningContext(context.Background(), exp, dest)
+}
+
+// ExecReturningContext execute insert, update or delete with Returning columns, then read returned rows to dest by Read.
+// oracle returns values of one row by RETURNING INTO, dest should be pointer to struct, map[string]interface{}, value of single column or slice of them
+func (db *DB) ExecReturningContext(ctx context.Context, exp Expression, dest interface{}) error {
+	o, oracle, err := db.checkReturning(exp)
+	if err != nil {
+		return err
+	}
+	if oracle {
+		return db.execOracleReturning(ctx, db, exp, o, dest)
+	}
+
+	rows, err := db.QueryExpContext(ctx, exp)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return read(rows, dest, db.nameMapper())
+}
+
+// Read is Read which map columns to struct fields by NameMapper of db
+func (db *DB) Read(rows *sql.Rows, dest interface{}) error {
+	return read(rows, dest, db.nameMapper())
+}
+
+// Each is Each which map columns to struct fields by NameMapper of db
+func (db *DB) Each(rows *sql.Rows, dest interface{}, fn func() error) error {
+	return each(rows, dest, fn, db.nameMapper())
+}
+
+// checkReturning return Output of exp and whether dialect is oracle, return error if exp can not return rows
+func (db *DB) checkReturning(exp Expression) (o *Output, oracle bool, err error) {
+	switch exp := exp.(type) {
+	case *Insert:
+		o = exp.Output
+	case *Update:
+		o = exp.Output
+	case *Delete:
+		o = exp.Output
+	default:
+		return nil, false, errors.New("returning expression should be insert, update or delete")
+	}
+	if o.isEmpty() {
+		return nil, false, errors.New("returning columns is empty")
+	}
+
+	dialect, err := db.dialecter()
+	if err != nil {
+		return nil, false, err
+	}
+	return o, dialect.Name() == "oracle", nil
+}
+
+// execOracleReturning execute exp and bind out parameters of RETURNING INTO to dest
+func (db *DB) execOracleReturning(ctx context.Context, qe queryExecer, exp Expression, o *Output, dest interface{}) error {
+	query, args, err := db.Compile(exp)
+	if err != nil {
+		return err
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("oracle returning does not support dest type %T", dest)
+	}
+	row := dv
+	slice := dv.Elem().Kind() == reflect.Slice
+	if slice {
+		row = reflect.New(dv.Elem().Type().Elem())
+	}
+
+	dests, fill, err := returningDests(o.Columns, row, db.nameMapper())
+	if err != nil {
+		return err
+	}
+
+	// out parameters of RETURNING INTO are last arguments
+	outs := args[len(args)-len(dests):]
+	for i := 0; i < len(outs); i++ {
+		out, ok := outs[i].(sql.Out)
+		if !ok {
+			return errors.New("oracle returning argument should be sql.Out")
+		}
+		out.Dest = dests[i]
+		outs[i] = out
+	}
+
+	if _, err = qe.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	fill()
+	if slice {
+		dv.Elem().Set(reflect.Append(dv.Elem(), row.Elem()))
+	}
+	return nil
+}
+
+// returningDests return destinations of out parameters of columns, row is pointer to struct, *struct, map[string]interface{}
+// or value of single column, fill copy values to map after execution
+func returningDests(columns []Column, row reflect.Value, mapper *NameMapper) (dests []interface{}, fill func(), err error) {
+	dests = make([]interface{}, len(columns))
+	fill = func() {}
+	v := row.Elem()
+	if v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		var si *structInfo
+		if si, err = getStructInfo(v.Type(), mapper); err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < len(columns); i++ {
+			_, name := columns[i].Split()
+			dests[i] = new(interface{})
+			if f, ok := si.FieldByColName(name); ok {
+				if fv, ok := fieldByIndex(v, f.index, true); ok && fv.CanAddr() {
+					dests[i] = fv.Addr().Interface()
+				}
+			}
+		}
+	case v.Type() == reflect.TypeOf(map[string]interface{}(nil)):
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		m := v.Interface().(map[string]interface{})
+		for i := 0; i < len(columns); i++ {
+			dests[i] = new(interface{})
+		}
+		fill = func() {
+			for i := 0; i < len(columns); i++ {
+				_, name := columns[i].Split()
+				m[name] = *(dests[i].(*interface{}))
+			}
+		}
+	case len(columns) == 1:
+		dests[0] = v.Addr().Interface()
+	default:
+		return nil, nil, fmt.Errorf("oracle returning does not support dest type %v", row.Type())
+	}
+	return dests, fill, nil
+}
+
+func (db *DB) getFnSchema(ctx context.Context, name string) (fn *ansi.DbFunction, err error) {
 	key := db.DSN.Name + ":" + name
 
 	if f, ok := _schemaCache.function(key); ok {
@@ -376,7 +604,7 @@ func (db *DB) getFnSchema(name string) (fn *ansi.DbFunction, err error) {
 		return
 	}
 
-	fn, err = db.Function(name)
+	fn, err = db.FunctionContext(ctx, name)
 	if LogLevel >= LogDebug {
 		logDebug("DB get schema:", name, fn, err)
 	}
@@ -388,8 +616,8 @@ func (db *DB) getFnSchema(name string) (fn *ansi.DbFunction, err error) {
 	return
 }
 
-func (db *DB) buildProcedure(name string, args Getter) (*Procedure, error) {
-	fn, err := db.getFnSchema(name)
+func (db *DB) buildProcedure(ctx context.Context, name string, args Getter) (*Procedure, error) {
+	fn, err := db.getFnSchema(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -423,46 +651,77 @@ func (db *DB) buildProcedure(name string, args Getter) (*Procedure, error) {
 
 // QueryFunc query a store procedure
 func (db *DB) QueryFunc(name string, args Getter) (*sql.Rows, error) {
-	sp, err := db.buildProcedure(name, args)
+	return db.QueryFuncContext(context.Background(), name, args)
+}
+
+// QueryFuncContext query a store procedure
+func (db *DB) QueryFuncContext(ctx context.Context, name string, args Getter) (*sql.Rows, error) {
+	sp, err := db.buildProcedure(ctx, name, args)
 	if err != nil {
 		return nil, err
 	}
 
 	var rows *sql.Rows
-	rows, err = db.QueryExp(sp)
-	// TODO: output parameter
+	rows, err = db.QueryExpContext(ctx, sp)
+	// use CallFunc to get output parameter
 	return rows, err
 }
 
 // ExecFunc exec a store procedure
 func (db *DB) ExecFunc(name string, args Getter) (sql.Result, error) {
-	sp, err := db.buildProcedure(name, args)
+	return db.ExecFuncContext(context.Background(), name, args)
+}
+
+// ExecFuncContext exec a store procedure
+func (db *DB) ExecFuncContext(ctx context.Context, name string, args Getter) (sql.Result, error) {
+	sp, err := db.buildProcedure(ctx, name, args)
 	if err != nil {
 		return nil, err
 	}
 
 	var result sql.Result
-	result, err = db.ExecExp(sp)
-	// TODO: output parameter
+	result, err = db.ExecExpContext(ctx, sp)
+	// use CallFunc to get output parameter
 	return result, err
 }
 
 // Delete delete table by conditions, conditions format is column, operator, value, ...
 func (db *DB) Delete(table string, conditions ...interface{}) (sql.Result, error) {
+	return db.DeleteContext(context.Background(), table, conditions...)
+}
+
+// DeleteContext delete table by conditions, conditions format is column, operator, value, ...
+func (db *DB) DeleteContext(ctx context.Context, table string, conditions ...interface{}) (sql.Result, error) {
+	d, err := db.buildDelete(table, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.ExecExpContext(ctx, d)
+}
+
+func (db *DB) buildDelete(table string, conditions []interface{}) (*Delete, error) {
 	d := NewDelete(table)
 	if err := db.buildWhere(d.Where, conditions); err != nil {
 		return nil, err
 	}
-
-	return db.ExecExp(d)
+	return d, nil
 }
 
 // DeleteByCol delete table with condition column = value
 func (db *DB) DeleteByCol(table string, column string, value interface{}) (sql.Result, error) {
+	return db.DeleteByColContext(context.Background(), table, column, value)
+}
+
+// DeleteByColContext delete table with condition column = value
+func (db *DB) DeleteByColContext(ctx context.Context, table string, column string, value interface{}) (sql.Result, error) {
+	return db.ExecExpContext(ctx, db.buildDeleteByCol(table, column, value))
+}
+
+func (db *DB) buildDeleteByCol(table string, column string, value interface{}) *Delete {
 	d := NewDelete(table)
 	d.Where.Compare(Equals, column, value)
-
-	return db.ExecExp(d)
+	return d
 }
 
 func (db *DB) buildWhere(w *Where, conditions []interface{}) error {
@@ -496,32 +755,54 @@ func (db *DB) buildWhere(w *Where, conditions []interface{}) error {
 
 // SelectAll return table.*  by conditions, conditions format is column, operator, value, ...
 func (db *DB) SelectAll(table string, conditions ...interface{}) (*sql.Rows, error) {
+	return db.SelectAllContext(context.Background(), table, conditions...)
+}
+
+// SelectAllContext return table.*  by conditions, conditions format is column, operator, value, ...
+func (db *DB) SelectAllContext(ctx context.Context, table string, conditions ...interface{}) (*sql.Rows, error) {
+	q, err := db.buildSelectAll(table, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryExpContext(ctx, q)
+}
+
+func (db *DB) buildSelectAll(table string, conditions []interface{}) (*Query, error) {
 	q := NewQuery(table, "")
 	if err := db.buildWhere(q.Where, conditions); err != nil {
 		return nil, err
 	}
-	return db.QueryExp(q)
+	return q, nil
 }
 
 // SelectExists return true if exists conditions
 func (db *DB) SelectExists(table string, conditions ...interface{}) (bool, error) {
-	count, err := db.SelectCount(table, conditions...)
+	return db.SelectExistsContext(context.Background(), table, conditions...)
+}
+
+// SelectExistsContext return true if exists conditions
+func (db *DB) SelectExistsContext(ctx context.Context, table string, conditions ...interface{}) (bool, error) {
+	count, err := db.SelectCountContext(ctx, table, conditions...)
 	if err != nil {
-		return false, nil
+		return false, err
 	}
 	return count > 0, nil
 }
 
 // SelectCount query select count(*) from [table] where conditions...
 func (db *DB) SelectCount(table string, conditions ...interface{}) (count int64, err error) {
-	q := NewQuery(table, "")
-	q.Select.Aggregate(Count, Sql("*"), "countof")
-	if err = db.buildWhere(q.Where, conditions); err != nil {
+	return db.SelectCountContext(context.Background(), table, conditions...)
+}
+
+// SelectCountContext query select count(*) from [table] where conditions...
+func (db *DB) SelectCountContext(ctx context.Context, table string, conditions ...interface{}) (count int64, err error) {
+	var q *Query
+	if q, err = db.buildSelectCount(table, conditions); err != nil {
 		return
 	}
 
 	var rows *sql.Rows
-	rows, err = db.QueryExp(q)
+	rows, err = db.QueryExpContext(ctx, q)
 	if err != nil {
 		return
 	}
@@ -533,14 +814,23 @@ func (db *DB) SelectCount(table string, conditions ...interface{}) (count int64,
 	return
 }
 
-func (db *DB) getTableSchema(name string) (table *ansi.DbTable, err error) {
+func (db *DB) buildSelectCount(table string, conditions []interface{}) (*Query, error) {
+	q := NewQuery(table, "")
+	q.Select.Aggregate(Count, Sql("*"), "countof")
+	if err := db.buildWhere(q.Where, conditions); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (db *DB) getTableSchema(ctx context.Context, name string) (table *ansi.DbTable, err error) {
 	key := db.DSN.Name + ":" + name
 	if t, ok := _schemaCache.table(key); ok {
 		table = t
 		return
 	}
 
-	table, err = db.Table(name)
+	table, err = db.TableContext(ctx, name)
 	if LogLevel >= LogDebug {
 		logDebug("DB get schema:", name, table, err)
 	}
@@ -554,8 +844,22 @@ func (db *DB) getTableSchema(name string) (table *ansi.DbTable, err error) {
 
 // Update update a table to data with conditions...
 func (db *DB) Update(table string, data Getter, conditions ...interface{}) (sql.Result, error) {
+	return db.UpdateContext(context.Background(), table, data, conditions...)
+}
+
+// UpdateContext update a table to data with conditions...
+func (db *DB) UpdateContext(ctx context.Context, table string, data Getter, conditions ...interface{}) (sql.Result, error) {
+	u, err := db.buildUpdate(ctx, table, data, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecExpContext(ctx, u)
+}
+
+func (db *DB) buildUpdate(ctx context.Context, table string, data Getter, conditions []interface{}) (*Update, error) {
+	data = db.entity(data)
 	var u *Update
-	t, err := db.getTableSchema(table)
+	t, err := db.getTableSchema(ctx, table)
 	if err != nil && ExplictSchema {
 		return nil, err
 	}
@@ -592,7 +896,7 @@ func (db *DB) Update(table string, data Getter, conditions ...interface{}) (sql.
 	}
 
 	db.buildWhere(u.Where, conditions)
-	return db.ExecExp(u)
+	return u, nil
 }
 
 // // Update update a table to data with conditions...
@@ -640,16 +944,39 @@ func (db *DB) Update(table string, data Getter, conditions ...interface{}) (sql.
 
 // UpdateColumn exec table.column = value where conditions...
 func (db *DB) UpdateColumn(table string, column string, value interface{}, conditions ...interface{}) (int64, error) {
+	return db.UpdateColumnContext(context.Background(), table, column, value, conditions...)
+}
+
+// UpdateColumnContext exec table.column = value where conditions...
+func (db *DB) UpdateColumnContext(ctx context.Context, table string, column string, value interface{}, conditions ...interface{}) (int64, error) {
+	return rowsAffectedErr(db.ExecExpContext(ctx, db.buildUpdateColumn(table, column, value, conditions)))
+}
+
+func (db *DB) buildUpdateColumn(table string, column string, value interface{}, conditions []interface{}) *Update {
 	u := NewUpdate(table)
 	u.Set(column, value)
 	db.buildWhere(u.Where, conditions)
-	return rowsAffectedErr(db.ExecExp(u))
+	return u
 }
 
 // Insert insert data to table
 func (db *DB) Insert(table string, data Getter) (sql.Result, error) {
+	return db.InsertContext(context.Background(), table, data)
+}
+
+// InsertContext insert data to table
+func (db *DB) InsertContext(ctx context.Context, table string, data Getter) (sql.Result, error) {
+	insert, err := db.buildInsert(ctx, table, data)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecExpContext(ctx, insert)
+}
+
+func (db *DB) buildInsert(ctx context.Context, table string, data Getter) (*Insert, error) {
+	data = db.entity(data)
 	var insert *Insert
-	t, err := db.getTableSchema(table)
+	t, err := db.getTableSchema(ctx, table)
 	if err != nil && ExplictSchema {
 		return nil, err
 	}
@@ -684,7 +1011,143 @@ func (db *DB) Insert(table string, data Getter) (sql.Result, error) {
 		}
 	}
 
-	return db.ExecExp(insert)
+	return insert, nil
+}
+
+// Upsert insert data to table, or update row if values of keys exist; keys are primary key columns if not provided
+func (db *DB) Upsert(table string, data Getter, keys ...string) (sql.Result, error) {
+	return db.UpsertContext(context.Background(), table, data, keys...)
+}
+
+// UpsertContext insert data to table, or update row if values of keys exist; keys are primary key columns if not provided
+func (db *DB) UpsertContext(ctx context.Context, table string, data Getter, keys ...string) (sql.Result, error) {
+	u, err := db.buildUpsert(ctx, table, data, keys)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecExpContext(ctx, u)
+}
+
+func (db *DB) buildUpsert(ctx context.Context, table string, data Getter, keys []string) (*Upsert, error) {
+	data = db.entity(data)
+	var u *Upsert
+	t, err := db.getTableSchema(ctx, table)
+	if err != nil && ExplictSchema {
+		return nil, err
+	}
+
+	if t == nil {
+		iterater, ok := data.(Iterater)
+		if !ok {
+			return nil, errors.New("data isn't a Iterater")
+		}
+		fields := iterater.Fields()
+		u = NewUpsert(table)
+		for i := 0; i < len(fields); i++ {
+			if v, ok := data.Get(fields[i]); ok {
+				u.Set(fields[i], v)
+			}
+		}
+	} else {
+		u = NewUpsert(t.Name)
+		for i := 0; i < len(t.Columns); i++ {
+			col := t.Columns[i]
+			if len(keys) == 0 && col.IsPrimaryKey {
+				u.Key(col.Name)
+			}
+			if col.IsReadOnly || (col.IsAutoIncrement && !col.IsPrimaryKey) {
+				continue
+			}
+			if v, ok := data.Get(col.Name); ok {
+				u.Set(col.Name, v)
+			}
+		}
+	}
+
+	u.Key(keys...)
+	if len(u.Sets) == 0 {
+		return nil, errors.New("data doesn't has any field")
+	}
+	if len(u.Keys) == 0 {
+		return nil, errors.New("upsert keys is empty:" + table)
+	}
+	return u, nil
+}
+
+// InsertMany insert rows of data to table in a transaction, return total rows affected
+func (db *DB) InsertMany(table string, data []Getter) (int64, error) {
+	return db.InsertManyContext(context.Background(), table, data)
+}
+
+// InsertManyContext insert rows of data to table in a transaction, return total rows affected
+func (db *DB) InsertManyContext(ctx context.Context, table string, data []Getter) (count int64, err error) {
+	err = db.InTxContext(ctx, func(tx *Tx) error {
+		var err error
+		count, err = tx.InsertManyContext(ctx, table, data)
+		return err
+	})
+	if err != nil {
+		count = 0
+	}
+	return
+}
+
+// buildInsertMany build multi-row inserts, rows are chunked by parameters limit of dialect.
+// columns are fields of first data
+func (db *DB) buildInsertMany(ctx context.Context, table string, data []Getter) ([]*Insert, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	first, err := db.buildInsert(ctx, table, data[0])
+	if err != nil {
+		return nil, err
+	}
+	cols := len(first.Sets)
+	if cols == 0 {
+		return nil, errors.New("data doesn't has any field")
+	}
+
+	dialect, err := db.dialecter()
+	if err != nil {
+		return nil, err
+	}
+	chunk := maxParameters(dialect) / cols
+	if max := maxInsertRows(dialect); max > 0 && chunk > max {
+		chunk = max
+	}
+	if chunk <= 0 {
+		return nil, errors.New("too many columns to insert:" + table)
+	}
+
+	inserts := make([]*Insert, 0, len(data)/chunk+1)
+	var insert *Insert
+	for i := 0; i < len(data); i++ {
+		if i%chunk == 0 {
+			insert = &Insert{Table: first.Table, Sets: make([]*Set, cols)}
+			inserts = append(inserts, insert)
+		}
+
+		row := db.entity(data[i])
+		values := make([]interface{}, cols)
+		for j := 0; j < cols; j++ {
+			col := first.Sets[j].Column.String()
+			v, ok := row.Get(col)
+			if !ok {
+				return nil, errors.New("data doesn't has field:" + col)
+			}
+			values[j] = v
+		}
+
+		if i%chunk == 0 {
+			for j := 0; j < cols; j++ {
+				insert.Sets[j] = newSet(first.Sets[j].Column.String(), asExpression(values[j]))
+			}
+		} else {
+			insert.Row(values...)
+		}
+	}
+	return inserts, nil
 }
 
 // // Insert insert data to table
@@ -0,0 +1,204 @@
+package kdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContextCanceled(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.ExecTextContext(ctx, "delete from ttable", nil); err != context.Canceled {
+		t.Errorf("ExecTextContext error; want=[%v]; actual=[%v]", context.Canceled, err)
+	}
+	if _, err := db.QueryExpContext(ctx, NewQuery("ttable", "")); err != context.Canceled {
+		t.Errorf("QueryExpContext error; want=[%v]; actual=[%v]", context.Canceled, err)
+	}
+	if _, err := db.SelectCountContext(ctx, "ttable"); err != context.Canceled {
+		t.Errorf("SelectCountContext error; want=[%v]; actual=[%v]", context.Canceled, err)
+	}
+	if ok, err := db.SelectExistsContext(ctx, "ttable"); ok || err != context.Canceled {
+		t.Errorf("SelectExistsContext error; want=[%v]; actual=[%v]", context.Canceled, err)
+	}
+	if err := db.InTxContext(ctx, func(tx *Tx) error { return nil }); err != context.Canceled {
+		t.Errorf("InTxContext error; want=[%v]; actual=[%v]", context.Canceled, err)
+	}
+
+	assertLog(t, source)
+}
+
+func TestTxContext(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	ctx := context.Background()
+	err := db.InTxContext(ctx, func(tx *Tx) error {
+		_, err := tx.DeleteByColContext(ctx, "ttable", "cint", 42)
+		return err
+	})
+	if err != nil {
+		t.Error("InTxContext error", err)
+	}
+
+	log := fakeLog(source)
+	if len(log) != 3 || removeSpace(log[1]) != removeSpace("DELETE FROM ttable WHERE cint = $1;") {
+		t.Errorf("Tx statements error; actual=[%v]", log)
+	}
+}
+
+func TestDSNQuoteIdentifier(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	db.DSN.QuoteIdentifier = true
+	if _, err := db.DeleteByCol("order", "desc", 1); err != nil {
+		t.Error("DeleteByCol error", err)
+	}
+
+	log := fakeLog(source)
+	if len(log) != 1 || removeSpace(log[0]) != removeSpace(`DELETE FROM "order" WHERE "desc" = $1;`) {
+		t.Errorf("quote statements error; actual=[%v]", log)
+	}
+}
+
+func TestExecReturning(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	fakeResult(source, "RETURNING", []string{"id"}, []driver.Value{int64(7)}, []driver.Value{int64(8)})
+
+	del := NewDelete("ttable").Returning("id")
+	del.Where.Equals("cint", 42)
+
+	var ids []int
+	if err := db.ExecReturning(del, &ids); err != nil {
+		t.Fatal("ExecReturning error", err)
+	}
+	if len(ids) != 2 || ids[0] != 7 || ids[1] != 8 {
+		t.Errorf("ExecReturning result error; actual=[%v]", ids)
+	}
+
+	if err := db.ExecReturning(NewDelete("ttable"), &ids); err == nil {
+		t.Error("ExecReturning should return error when returning columns is empty")
+	}
+}
+
+func TestExecReturningOracle(t *testing.T) {
+	db, source := newFakeDB(t, "fakeoracle")
+	defer db.Close()
+	db.NameMapper = SnakeMapper
+
+	fakeResult(source, "RETURNING", []string{"user_id", "user_name"}, []driver.Value{int64(7), "x"})
+
+	u := NewUpdate("tmapper").Set("mail", "a").Returning("user_id", "user_name")
+	u.Where.Equals("user_id", 7)
+
+	var user tMappedUser
+	if err := db.ExecReturning(u, &user); err != nil {
+		t.Fatal("ExecReturning oracle error", err)
+	}
+	if user.UserID != 7 || user.UserName != "x" {
+		t.Errorf("ExecReturning oracle struct error; actual=[%v]", user)
+	}
+	log := fakeLog(source)
+	if want := `UPDATE tmapper SET mail=:pv1 WHERE user_id = :pv2 RETURNING user_id, user_name INTO :pv3, :pv4`; removeSpace(log[len(log)-1]) != removeSpace(want) {
+		t.Errorf("ExecReturning oracle statement error; actual=[%v]", log[len(log)-1])
+	}
+
+	var rows []map[string]interface{}
+	if err := db.ExecReturning(u, &rows); err != nil || len(rows) != 1 || rows[0]["user_id"] != int64(7) || rows[0]["user_name"] != "x" {
+		t.Error("ExecReturning oracle map error", err, rows)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin error", err)
+	}
+	defer tx.Rollback()
+	var ids []int
+	del := NewDelete("tmapper").Returning("user_id")
+	if err = tx.ExecReturning(del, &ids); err != nil || len(ids) != 1 || ids[0] != 7 {
+		t.Error("Tx ExecReturning oracle error", err, ids)
+	}
+}
+
+func TestInsertMany(t *testing.T) {
+	db, source := newFakeDB(t, "fakemssql")
+	defer db.Close()
+
+	fakeTable(source, "ttable", "", "cint", "cstring", "cfloat")
+
+	data := make([]Getter, 1500)
+	for i := 0; i < len(data); i++ {
+		data[i] = Map{"cint": i, "cstring": "s", "cfloat": 1.1}
+	}
+
+	count, err := db.InsertMany("ttable", data)
+	if err != nil {
+		t.Fatal("InsertMany error", err)
+	}
+	if count != int64(len(data)) {
+		t.Errorf("InsertMany rows affected error; actual=[%v]", count)
+	}
+
+	var params []int
+	args := fakeArgs(source)
+	for i, s := range fakeLog(source) {
+		if strings.HasPrefix(s, "INSERT") {
+			params = append(params, len(args[i]))
+		}
+	}
+	// 2098 parameters / 3 columns = 699 rows per statement
+	if want := []int{2097, 2097, 306}; !reflect.DeepEqual(params, want) {
+		t.Errorf("InsertMany parameters of statements error; want=[%v]; actual=[%v]", want, params)
+	}
+
+	if _, err = db.InsertMany("ttable", []Getter{Map{"cint": 1, "cstring": "s", "cfloat": 1.1}, Map{"cint": 2}}); err == nil {
+		t.Error("InsertMany should return error when data doesn't has field")
+	}
+}
+
+func TestDBUpsert(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	fakeTable(source, "ttable", "id", "id", "cstring")
+
+	if _, err := db.Upsert("ttable", Map{"id": 1, "cstring": "a"}); err != nil {
+		t.Fatal("Upsert error", err)
+	}
+
+	log := fakeLog(source)
+	want := `INSERT INTO ttable(id, cstring) VALUES($1, $2) ON CONFLICT (id) DO UPDATE SET cstring=EXCLUDED.cstring;`
+	if removeSpace(log[len(log)-1]) != removeSpace(want) {
+		t.Errorf("Upsert statement error; actual=[%v]", log[len(log)-1])
+	}
+}
+
+func TestQueryExpCompound(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	fakeResult(source, "UNION", []string{"cint"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+
+	c := NewCompound(NewQuery("ttable", "")).Union(NewQuery("ttable_c", ""))
+	rows, err := db.QueryExp(c)
+	if err != nil {
+		t.Fatal("QueryExp compound error", err)
+	}
+
+	var values []int
+	if err = Read(rows, &values); err != nil {
+		t.Fatal("read compound rows error", err)
+	}
+	if len(values) != 2 || values[0] != 1 || values[1] != 2 {
+		t.Errorf("compound result error; actual=[%v]", values)
+	}
+}
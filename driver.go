@@ -2,6 +2,7 @@ package kdb
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -49,6 +50,18 @@ func GetCompiler(driver string) (Compiler, error) {
 	return c, nil
 }
 
+// CompileOptions is options of compiling expression
+type CompileOptions struct {
+	// QuoteIdentifier quote table, alias and column names by Dialecter.Quote
+	QuoteIdentifier bool
+}
+
+// OptionCompiler is a Compiler that compile expression with options
+type OptionCompiler interface {
+	// CompileWithOptions compile expression with provided options
+	CompileWithOptions(source string, exp Expression, options CompileOptions) (query string, args []interface{}, err error)
+}
+
 // Schemaer is a interface that get schema of table,view,function
 type Schemaer interface {
 	// Table return schema of table,view
@@ -58,6 +71,15 @@ type Schemaer interface {
 	Function(db *sql.DB, name string) (*ansi.DbFunction, error)
 }
 
+// ContextSchemaer is a Schemaer that get schema with context
+type ContextSchemaer interface {
+	// TableContext return schema of table,view
+	TableContext(ctx context.Context, db *sql.DB, name string) (*ansi.DbTable, error)
+
+	// FunctionContext return schema of store procedure,function
+	FunctionContext(ctx context.Context, db *sql.DB, name string) (*ansi.DbFunction, error)
+}
+
 var _schemaers = make(map[string]Schemaer)
 
 // RegisterSchemaer makes a schemaer available by the provided driver name.
@@ -171,7 +193,7 @@ func (ad AnsiDialecter) QuoteString(s string) string {
 
 // Quote quote s as "s"
 func (ad AnsiDialecter) Quote(s string) string {
-	return "\"" + s + "\""
+	return "\"" + strings.Replace(s, "\"", "\"\"", -1) + "\""
 }
 
 // TableSql return ""
@@ -251,9 +273,14 @@ func (sqlite SqliteDialecter) Name() string {
 
 // Table return schema of table,view
 func (sqlite SqliteDialecter) Table(db *sql.DB, name string) (table *ansi.DbTable, err error) {
+	return sqlite.TableContext(context.Background(), db, name)
+}
+
+// TableContext return schema of table,view
+func (sqlite SqliteDialecter) TableContext(ctx context.Context, db *sql.DB, name string) (table *ansi.DbTable, err error) {
 	query := fmt.Sprintf(`SELECT name, type FROM sqlite_master WHERE name = '%s'; `, name)
 	var rows *sql.Rows
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -276,7 +303,7 @@ func (sqlite SqliteDialecter) Table(db *sql.DB, name string) (table *ansi.DbTabl
 	}
 
 	query = fmt.Sprintf("PRAGMA table_info(%s)", t.Name)
-	if rows, err = db.Query(query); err != nil {
+	if rows, err = db.QueryContext(ctx, query); err != nil {
 		return
 	}
 
@@ -302,12 +329,20 @@ func (sqlite SqliteDialecter) Table(db *sql.DB, name string) (table *ansi.DbTabl
 
 // Function return schema of store procedure,function
 func (sqlite SqliteDialecter) Function(db *sql.DB, name string) (*ansi.DbFunction, error) {
+	return sqlite.FunctionContext(context.Background(), db, name)
+}
+
+// FunctionContext return schema of store procedure,function
+func (sqlite SqliteDialecter) FunctionContext(ctx context.Context, db *sql.DB, name string) (*ansi.DbFunction, error) {
 	return nil, errors.New("sqlite doesn't support store procedure")
 }
 
 // MssqlDialecter is ms sql server dialect
 type MssqlDialecter struct {
 	AnsiDialecter
+
+	// Version is major version of sql server, like 10 (2008), 11 (2012); 0 means latest
+	Version int
 }
 
 // Name return "mssql"
@@ -317,7 +352,7 @@ func (mssql MssqlDialecter) Name() string {
 
 // Quote quote s as [s]
 func (mssql MssqlDialecter) Quote(s string) string {
-	return "[" + s + "]"
+	return "[" + strings.Replace(s, "]", "]]", -1) + "]"
 }
 
 // TableSql return sql to query table schema
@@ -389,6 +424,9 @@ func (mssql MssqlDialecter) ParametersSql(name string) string {
 // MysqlDialecter is Mysql dialect
 type MysqlDialecter struct {
 	AnsiDialecter
+
+	// Version is major version of mysql, like 5, 8; 0 means latest
+	Version int
 }
 
 // Name return "mysql"
@@ -401,9 +439,9 @@ func (mysql MysqlDialecter) QuoteString(s string) string {
 	return "\"" + s + "\""
 }
 
-// Quote quote s as 's'
+// Quote quote s as `s`
 func (mysql MysqlDialecter) Quote(s string) string {
-	return "'" + s + "'"
+	return "`" + strings.Replace(s, "`", "``", -1) + "`"
 }
 
 // TableSql return sql to query table schema
@@ -455,9 +493,9 @@ func (pgsql PostgreSQLDialecter) QuoteString(s string) string {
 	return "'" + s + "'"
 }
 
-// Quote quote s as 's'
+// Quote quote s as "s"
 func (pgsql PostgreSQLDialecter) Quote(s string) string {
-	return "\"" + s + "\""
+	return "\"" + strings.Replace(s, "\"", "\"\"", -1) + "\""
 }
 
 // Table return sql to query table schema
@@ -538,6 +576,9 @@ order by
 // OracleSQLDialecter is oracle dialect
 type OracleSQLDialecter struct {
 	AnsiDialecter
+
+	// Version is major version of oracle, like 11, 12; 0 means latest
+	Version int
 }
 
 // Name return "oracle"
@@ -560,9 +601,9 @@ func (oracle OracleSQLDialecter) SupportIndexedParameter() bool {
 	return true
 }
 
-// Quote doesn't quote identifier 
+// Quote quote s as "s"
 func (oracle OracleSQLDialecter) Quote(s string) string {
-	return s
+	return "\"" + strings.Replace(s, "\"", "\"\"", -1) + "\""
 }
 
 // Table return sql to query table schema
@@ -652,6 +693,11 @@ func NewSqlDriver(dialecter Dialecter) Compiler {
 
 // Compile compile expression to ansi sql
 func (c *SqlDriver) Compile(source string, exp Expression) (query string, args []interface{}, err error) {
+	return c.CompileWithOptions(source, exp, CompileOptions{})
+}
+
+// CompileWithOptions compile expression to ansi sql with provided options
+func (c *SqlDriver) CompileWithOptions(source string, exp Expression, options CompileOptions) (query string, args []interface{}, err error) {
 	if exp == nil {
 		err = errors.New("compile expression is nil")
 		return
@@ -664,8 +710,10 @@ func (c *SqlDriver) Compile(source string, exp Expression) (query string, args [
 	case NodeProcedure:
 		p, _ := exp.(*Procedure)
 		return c.compileProcedure(p, source)
-	case NodeQuery, NodeUpdate, NodeInsert, NodeDelete:
-		return NewStmtCompiler(c.Dialecter).Compile(exp, source)
+	case NodeQuery, NodeUpdate, NodeInsert, NodeDelete, NodeUpsert, NodeCompound:
+		sc := NewStmtCompiler(c.Dialecter)
+		sc.QuoteIdentifier = options.QuoteIdentifier
+		return sc.Compile(exp, source)
 	}
 
 	err = errors.New(fmt.Sprint("compile expression does support type:", exp.Node()))
@@ -748,63 +796,84 @@ func (c *SqlDriver) compileText(text *Text, source string) (query string, args [
 }
 
 func (c *SqlDriver) compileMysqlProcedure(sp *Procedure, source string) (query string, args []interface{}, err error) {
-	l := len(sp.Parameters)
-	paramters := make([]interface{}, 0, l)
+	sets, call, out := mysqlProcedureStmts(sp)
 	buffer := &sqlWriter{}
-	returnName := sp.ReturnParameterName()
-	hasOut := false
 
+	for i := 0; i < len(sets); i++ {
+		buffer.Print(sets[i].sql, "; \n")
+		args = append(args, sets[i].args...)
+	}
+	buffer.Print(call.sql, ";")
+	args = append(args, call.args...)
+	if out != "" {
+		buffer.Print("\n", out, "; ")
+	}
+
+	query = buffer.String()
+	return
+}
+
+// mysqlStmt is a statement and it's arguments
+type mysqlStmt struct {
+	sql  string
+	args []interface{}
+}
+
+// mysqlProcedureStmts return statements to call mysql procedure: set inout parameters to session variables,
+// call procedure, then select out and return parameters, out is empty if there is no out or return parameter
+func mysqlProcedureStmts(sp *Procedure) (sets []mysqlStmt, call mysqlStmt, out string) {
+	l := len(sp.Parameters)
 	for i := 0; i < l; i++ {
 		p := sp.Parameters[i]
 		if p.Dir == ansi.DirInOut {
-			buffer.Print("SET @", p.Name, " = ?; \n")
-			paramters = append(paramters, p.Value)
+			sets = append(sets, mysqlStmt{sql: "SET @" + p.Name + " = ?", args: []interface{}{p.Value}})
 		}
 	}
 
+	w := &sqlWriter{}
+	returnName := sp.ReturnParameterName()
 	if returnName == "" {
-		buffer.WriteString("CALL ")
+		w.WriteString("CALL ")
 	} else {
-		buffer.WriteString("SET @" + returnName)
+		w.WriteString("SET @" + returnName + " = ")
 	}
-	buffer.WriteString(sp.Name)
-	buffer.WriteString(" ( ")
+	w.WriteString(sp.Name)
+	w.WriteString(" ( ")
+	split := false
 	for i := 0; i < l; i++ {
-		if i > 0 {
-			buffer.WriteString(", ")
-		}
 		p := sp.Parameters[i]
+		if p.Dir == ansi.DirReturn {
+			continue
+		}
+		if split {
+			w.Comma()
+		}
+		split = true
 		if p.Dir == ansi.DirIn {
-			buffer.WriteString("?")
-			paramters = append(paramters, p.Value)
-		} else if p.Dir == ansi.DirInOut {
-			buffer.Print("@", p.Name)
-			hasOut = true
-		} else if p.Dir == ansi.DirOut {
-			buffer.Print("@", p.Name)
-			hasOut = true
+			w.WriteString("?")
+			call.args = append(call.args, p.Value)
+		} else {
+			w.Print("@", p.Name)
 		}
 	}
-	buffer.WriteString(" );")
+	w.WriteString(" )")
+	call.sql = w.String()
 
-	if hasOut || returnName != "" {
-		buffer.WriteString("\nSELECT ")
-		delimit := false
-		for i := 0; i < l; i++ {
-			p := sp.Parameters[i]
-			if p.IsOut() || p.Dir == ansi.DirReturn {
-				if delimit {
-					buffer.WriteString(", ")
-				}
-				buffer.Print("@", p.Name)
-				delimit = true
+	w = &sqlWriter{}
+	split = false
+	for i := 0; i < l; i++ {
+		p := sp.Parameters[i]
+		if p.IsOut() || p.Dir == ansi.DirReturn {
+			if split {
+				w.Comma()
+			} else {
+				w.WriteString("SELECT ")
 			}
+			split = true
+			w.Print("@", p.Name, " AS ", p.Name)
 		}
-		buffer.WriteString("; ")
 	}
-
-	query = buffer.String()
-	args = paramters
+	out = w.String()
 	return
 }
 
@@ -828,21 +897,24 @@ func (c *SqlDriver) compileOracleProcedure(sp *Procedure, source string) (query
 		w.WriteString("begin " + sp.Name + "( ")
 	} else {
 		w.WriteString("begin :" + retName + ":= " + sp.Name + "( ")
+		ret, _ := sp.FindParameter(retName)
+		paramters = append(paramters, ret.Value)
 	}
 
 	for i := 0; i < l; i++ {
 		p := sp.Parameters[i]
+		if p.Dir == ansi.DirReturn {
+			continue
+		}
 
 		if split {
 			w.Comma()
 		}
 		split = true
 
-		if p.Dir != ansi.DirReturn {
-			w.WriteString(p.Name + "=>:" + p.Name)
-			index++
-			paramters = append(paramters, p.Value)
-		}
+		w.WriteString(p.Name + "=>:" + p.Name)
+		index++
+		paramters = append(paramters, p.Value)
 	}
 	w.WriteString(" ); end; ")
 
@@ -873,8 +945,9 @@ func (c *SqlDriver) compileMssqlProcedure(sp *Procedure, source string) (query s
 	paramters := make([]interface{}, 0, l)
 	split := false
 	w := &sqlWriter{}
+	retName := sp.ReturnParameterName()
 
-	if !sp.HasOutParameter() {
+	if !sp.HasOutParameter() && retName == "" {
 		w.Print("exec ", sp.Name, " ")
 
 		for i := 0; i < l; i++ {
@@ -917,7 +990,13 @@ func (c *SqlDriver) compileMssqlProcedure(sp *Procedure, source string) (query s
 	}
 
 	split = false
-	w.Print("exec ", sp.Name, " ")
+	if retName == "" {
+		w.Print("exec ", sp.Name, " ")
+	} else {
+		// return value of sql server procedure is always int
+		w.Print("declare @kdbr int\n")
+		w.Print("exec @kdbr = ", sp.Name, " ")
+	}
 	for i := 0; i < l; i++ {
 		p := sp.Parameters[i]
 		if p.Dir == ansi.DirReturn {
@@ -946,7 +1025,13 @@ func (c *SqlDriver) compileMssqlProcedure(sp *Procedure, source string) (query s
 				w.Comma()
 			}
 			split = true
-			w.Print("@kdbp", strconv.Itoa(i))
+			w.Print("@kdbp", strconv.Itoa(i), " AS ", c.Dialecter.Quote(p.Name))
+		} else if p.Dir == ansi.DirReturn {
+			if split {
+				w.Comma()
+			}
+			split = true
+			w.Print("@kdbr AS ", c.Dialecter.Quote(p.Name))
 		}
 	}
 
@@ -958,7 +1043,6 @@ func (c *SqlDriver) compileMssqlProcedure(sp *Procedure, source string) (query s
 	// select @p2, @p3
 	query = w.String()
 	args = paramters
-	fmt.Print(query)
 	return
 }
 
@@ -1017,13 +1101,23 @@ func (c *SqlDriver) compileProcedure(sp *Procedure, source string) (query string
 // StmtCompiler can compile Update, Insert, Delete, Query
 type StmtCompiler struct {
 	// Dialecter is a provided Dialecter
-	Dialecter   Dialecter
+	Dialecter Dialecter
+
+	// QuoteIdentifier quote table, alias and column names by Dialecter.Quote
+	QuoteIdentifier bool
+
 	exp         Expression
 	source      string
 	w           *sqlWriter
 	args        []interface{}
 	paraIndex   int
 	placeHolder string
+
+	// depth is nesting depth of sub query
+	depth int
+
+	// tableLock is lock of current query, compiled to table hints on sql server
+	tableLock *Lock
 }
 
 // NewStmtCompiler return  *StmtCompiler with provided Dialecter
@@ -1034,12 +1128,33 @@ func NewStmtCompiler(dialecter Dialecter) *StmtCompiler {
 	}
 }
 
+// compileError is panic value of StmtCompiler.throw, recovered by StmtCompiler.Compile
+type compileError struct {
+	err error
+}
+
+// throw abort compiling with an error
+func (sc *StmtCompiler) throw(message string) {
+	panic(compileError{err: errors.New(message)})
+}
+
 // Compile compile expression to ansi sql
 func (sc *StmtCompiler) Compile(exp Expression, source string) (query string, args []interface{}, err error) {
 	if exp == nil {
 		err = errors.New("compile expression is nil")
+		return
 	}
 
+	defer func() {
+		if r := recover(); r != nil {
+			ce, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			query, args, err = "", nil, ce.err
+		}
+	}()
+
 	sc.w = &sqlWriter{}
 	sc.source = source
 	sc.placeHolder = sc.Dialecter.ParameterPlaceHolder()
@@ -1053,6 +1168,11 @@ func (sc *StmtCompiler) Compile(exp Expression, source string) (query string, ar
 		sc.visitInsert(exp)
 	case NodeDelete:
 		sc.visitDelete(exp)
+	case NodeUpsert:
+		sc.visitUpsert(exp)
+	case NodeCompound:
+		c, _ := exp.(*Compound)
+		sc.visitCompound(c)
 	default:
 		err = errors.New("doesn't support expression type:" + exp.Node().String())
 	}
@@ -1071,6 +1191,26 @@ func (sc *StmtCompiler) writeQuote(s string) {
 	sc.w.WriteString(sc.Dialecter.Quote(s))
 }
 
+// writeIdentifier write name of table or alias, each part split by dot is quoted if QuoteIdentifier is true
+func (sc *StmtCompiler) writeIdentifier(name string) {
+	if !sc.QuoteIdentifier {
+		sc.w.WriteString(name)
+		return
+	}
+
+	parts := strings.Split(name, ansi.Split)
+	for i := 0; i < len(parts); i++ {
+		if i > 0 {
+			sc.w.WriteString(ansi.Split)
+		}
+		if parts[i] == "" || parts[i] == ansi.WildcardAll {
+			sc.w.WriteString(parts[i])
+		} else {
+			sc.writeQuote(parts[i])
+		}
+	}
+}
+
 func (sc *StmtCompiler) visitExp(exp Expression) {
 	if exp == nil {
 		return
@@ -1079,7 +1219,7 @@ func (sc *StmtCompiler) visitExp(exp Expression) {
 	switch exp.Node() {
 	case NodeZero:
 		return
-	case NodeText, NodeProcedure, NodeParameter, NodeOutput:
+	case NodeText, NodeProcedure, NodeParameter:
 		panic("doesn't support this expression type:" + exp.Node().String())
 	case NodeNull, NodeSql, NodeOperator:
 		sql, ok := exp.(RawSqler)
@@ -1093,12 +1233,14 @@ func (sc *StmtCompiler) visitExp(exp Expression) {
 	switch exp := exp.(type) {
 	case *Insert:
 		sc.visitInsert(exp)
-	case *Query:
-		sc.visitQuery(exp)
+	case *Query, *Compound:
+		sc.visitSubQuery(exp)
 	case *Update:
 		sc.visitUpdate(exp)
 	case *Delete:
 		sc.visitDelete(exp)
+	case *Upsert:
+		sc.visitUpsert(exp)
 	case *Value:
 		sc.visitValue(exp)
 	case *Table:
@@ -1115,6 +1257,12 @@ func (sc *StmtCompiler) visitExp(exp Expression) {
 	// 	sc.visitSet(exp)
 	case *Aggregate:
 		sc.visitAggregate(exp)
+	case *Call:
+		sc.visitCall(exp)
+	case *Case:
+		sc.visitCase(exp)
+	case *Window:
+		sc.visitWindow(exp)
 	case *Select:
 		sc.visitSelect(exp)
 	case *From:
@@ -1129,6 +1277,8 @@ func (sc *StmtCompiler) visitExp(exp Expression) {
 		sc.visitHaving(exp)
 	case *OrderBy:
 		sc.visitOrderBy(exp)
+	case *Output:
+		sc.visitReturning(exp)
 		// case *Func:
 		// 	sc.visitFunc(exp)
 	}
@@ -1145,6 +1295,192 @@ func (sc *StmtCompiler) visitAggregate(a *Aggregate) {
 	sc.w.CloseParentheses()
 }
 
+// visitCall write function call, portable function is compiled to native function of dialect
+func (sc *StmtCompiler) visitCall(c *Call) {
+	if c == nil || c.Name == "" {
+		sc.throw("function name is empty")
+	}
+
+	name := sc.Dialecter.Name()
+	switch c.Name {
+	case CurrentTime:
+		if len(c.Args) > 0 {
+			sc.throw("current time doesn't accept arguments")
+		}
+		sc.w.WriteString(currentTimeOf(sc.Dialecter))
+		return
+	case Concat:
+		op := " || "
+		if name == "mysql" {
+			op = ""
+		} else if name == "mssql" {
+			if version := dialectVersion(sc.Dialecter); version > 0 && version < 11 {
+				// sql server before 2012 doesn't support CONCAT
+				op = " + "
+			} else {
+				op = ""
+			}
+		}
+		if op != "" {
+			sc.w.OpenParentheses()
+			for i := 0; i < len(c.Args); i++ {
+				if i > 0 {
+					sc.w.WriteString(op)
+				}
+				sc.visitExp(c.Args[i])
+			}
+			sc.w.CloseParentheses()
+			return
+		}
+	}
+
+	sc.w.WriteString(nativeFunc(sc.Dialecter, c.Name))
+	sc.w.OpenParentheses()
+	for i := 0; i < len(c.Args); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitExp(c.Args[i])
+	}
+	sc.w.CloseParentheses()
+}
+
+// nativeFunc return native function name of portable function, other function name is returned as it is
+func nativeFunc(d Dialecter, f Func) string {
+	switch f {
+	case Coalesce, Lower, Upper, Concat:
+		return strings.ToUpper(f.String())
+	case Substring:
+		if d.Name() == "oracle" || d.Name() == "sqlite" {
+			return "SUBSTR"
+		}
+		return "SUBSTRING"
+	}
+	return f.String()
+}
+
+// currentTimeOf return sql of current date and time
+func currentTimeOf(d Dialecter) string {
+	switch d.Name() {
+	case "mysql", "postgres":
+		return "NOW()"
+	case "mssql":
+		return "GETDATE()"
+	case "oracle":
+		return "SYSDATE"
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// visitWindow write fn OVER (PARTITION BY ... ORDER BY ... frame), throw error if dialect doesn't support it
+func (sc *StmtCompiler) visitWindow(w *Window) {
+	if w == nil || w.Func == nil {
+		sc.throw("function of window is nil")
+	}
+
+	version := dialectVersion(sc.Dialecter)
+	switch sc.Dialecter.Name() {
+	case "mysql":
+		if version > 0 && version < 8 {
+			sc.throw("mysql before 8.0 doesn't support window function")
+		}
+	case "mssql":
+		if _, ok := w.Func.(*Aggregate); ok && version > 0 && version < 11 && (hasOrderBy(w.OrderBy) || w.Frame != nil) {
+			sc.throw("sql server before 2012 doesn't support order by or frame in window of aggregate function")
+		}
+		if c, ok := w.Func.(*Call); ok && version > 0 && version < 11 && isWindowFunc(c.Name, Lag, Lead, FirstValue, LastValue) {
+			sc.throw(fmt.Sprintf("sql server before 2012 doesn't support function %s", c.Name))
+		}
+	}
+
+	sc.visitExp(w.Func)
+	sc.w.Print(" ", ansi.Over, " (")
+	split := false
+	if len(w.PartitionBy) > 0 {
+		sc.w.Print(ansi.PartitionBy, " ")
+		for i := 0; i < len(w.PartitionBy); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.visitExp(w.PartitionBy[i])
+		}
+		split = true
+	}
+	if hasOrderBy(w.OrderBy) {
+		if split {
+			sc.w.Blank()
+		}
+		sc.w.Print(ansi.OrderBy, " ")
+		sc.visitOrderByFields(w.OrderBy)
+		split = true
+	}
+	if f := w.Frame; f != nil {
+		if f.Start == "" || (f.Unit != FrameRows && f.Unit != FrameRange) {
+			sc.throw("frame of window should have unit and start")
+		}
+		if c, ok := w.Func.(*Call); ok && isWindowFunc(c.Name, RowNumber, Rank, DenseRank) {
+			sc.throw(fmt.Sprintf("ranking function %s doesn't support frame", c.Name))
+		}
+		if f.Unit == FrameRange && !hasOrderBy(w.OrderBy) && (isOffsetBound(f.Start) || isOffsetBound(f.End)) {
+			sc.throw("range frame with offset requires order by")
+		}
+		if split {
+			sc.w.Blank()
+		}
+		if f.End == "" {
+			sc.w.Print(f.Unit.String(), " ", f.Start.String())
+		} else {
+			sc.w.Print(f.Unit.String(), " ", ansi.Between, " ", f.Start.String(), " ", ansi.And, " ", f.End.String())
+		}
+	}
+	sc.w.CloseParentheses()
+}
+
+// visitCase write CASE [exp] WHEN ... THEN ... ELSE ... END
+func (sc *StmtCompiler) visitCase(c *Case) {
+	if c == nil || len(c.Whens) == 0 {
+		sc.throw("case expression should have when clause")
+	}
+
+	sc.w.WriteString(ansi.Case)
+	if c.Exp != nil {
+		sc.w.Blank()
+		sc.visitExp(c.Exp)
+	}
+	for i := 0; i < len(c.Whens); i++ {
+		w := c.Whens[i]
+		sc.w.Print(" ", ansi.When, " ")
+		if c.Exp != nil {
+			sc.visitExp(w.Value)
+		} else if !w.Conditions.isEmpty() {
+			sc.visitCaseConditions(w.Conditions)
+		} else {
+			sc.throw("condition of case when is empty")
+		}
+		sc.w.Print(" ", ansi.Then, " ")
+		sc.visitExp(w.Result)
+	}
+	if c.Else != nil {
+		sc.w.Print(" ", ansi.Else, " ")
+		sc.visitExp(c.Else)
+	}
+	sc.w.Print(" ", ansi.End)
+}
+
+// visitCaseConditions write conditions in one line
+func (sc *StmtCompiler) visitCaseConditions(c *Conditions) {
+	for i := 0; i < len(c.Conditions); i++ {
+		item := c.Conditions[i]
+		if item == nil {
+			continue
+		}
+		if i > 0 && item != CloseParentheses && c.Conditions[i-1] != OpenParentheses {
+			sc.w.Blank()
+		}
+		sc.visitExp(item)
+	}
+}
+
 func (sc *StmtCompiler) writeValue(v interface{}) {
 	if v == nil {
 		sc.w.WriteString(ansi.Null)
@@ -1187,29 +1523,78 @@ func (sc *StmtCompiler) visitValue(v *Value) {
 }
 
 func (sc *StmtCompiler) visitColumn(c Column) {
-	sc.w.WriteString(c.String())
-
-	// table, column := c.Split()
-	// if table == "" {
-	// 	sc.WriteQuote(column)
-	// } else {
-	// 	sc.WriteQuote(table)
-	// 	sc.w.WriteString(".")
-	// 	sc.WriteQuote(column)
-	// }
+	if !sc.QuoteIdentifier {
+		sc.w.WriteString(c.String())
+		return
+	}
+
+	table, column := c.Split()
+	if table != "" {
+		sc.writeIdentifier(table)
+		sc.w.WriteString(ansi.Split)
+	}
+	if column == ansi.WildcardAll {
+		sc.w.WriteString(column)
+	} else {
+		sc.writeQuote(column)
+	}
+}
+
+// visitSubQuery write (query), parameters are numbered continuously
+func (sc *StmtCompiler) visitSubQuery(exp Expression) {
+	sc.w.OpenParentheses()
+	sc.depth++
+	switch exp := exp.(type) {
+	case *Query:
+		sc.visitQuery(exp)
+	case *Compound:
+		sc.visitCompound(exp)
+	}
+	sc.depth--
+	sc.w.CloseParentheses()
+}
+
+// isSubQuery return true if exp is *Query or *Compound
+func isSubQuery(exp Expression) bool {
+	switch exp.(type) {
+	case *Query, *Compound:
+		return true
+	}
+	return false
+}
 
+// writeTableAlias write AS alias, oracle doesn't support AS for table alias
+func (sc *StmtCompiler) writeTableAlias(alias string) {
+	if sc.Dialecter.Name() == "oracle" {
+		sc.w.Blank()
+	} else {
+		sc.w.Print(" ", ansi.As, " ")
+	}
+	sc.writeIdentifier(alias)
 }
+
 func (sc *StmtCompiler) visitTable(t *Table) {
-	if t == nil || (t.Name == "" && t.Alias == "") {
+	if t == nil {
+		return
+	} else if t.Query != nil {
+		sc.visitSubQuery(t.Query)
+		if t.Alias != "" {
+			sc.writeTableAlias(t.Alias)
+		}
+	} else if t.Name == "" && t.Alias == "" {
 		return
 	} else if t.Name != "" && t.Alias != "" {
-		sc.w.Print(t.Name, " ", ansi.As, " ", t.Alias)
+		sc.writeIdentifier(t.Name)
+		sc.writeTableAlias(t.Alias)
 	} else if t.Alias == "" {
-		sc.w.WriteString(t.Name)
+		sc.writeIdentifier(t.Name)
 	} else if t.Name == "" {
-		sc.w.WriteString(t.Alias)
+		sc.writeIdentifier(t.Alias)
 	}
 
+	if sc.tableLock != nil && sc.tableLock.locks(t) {
+		sc.writeTableHint(sc.tableLock)
+	}
 	return
 }
 
@@ -1221,38 +1606,130 @@ func (sc *StmtCompiler) visitCondition(c *Condition) {
 	if c.Right == nil && c.Left == nil {
 		sc.w.WriteString(c.Op.String())
 	} else if c.Left == nil {
-		sc.w.Print(c.Op.String(), "(")
-		sc.visitExp(c.Right)
-		sc.w.Print(")")
+		if isSubQuery(c.Right) {
+			sc.w.Print(c.Op.String(), " ")
+			sc.visitExp(c.Right)
+		} else {
+			sc.w.Print(c.Op.String(), "(")
+			sc.visitExp(c.Right)
+			sc.w.Print(")")
+		}
 	} else if c.Right == nil {
 		sc.visitExp(c.Left)
 		sc.w.Print(" ", c.Op.String())
 	} else {
-		if c.Op == In || c.Op == NotIn {
+		switch c.Op {
+		case In, NotIn:
 			sc.visitIn(c)
-		} else {
+		case Between, NotBetween:
+			sc.visitBetween(c)
+		case IsDistinctFrom, IsNotDistinct:
+			sc.visitDistinct(c)
+		default:
 			sc.visitExp(c.Left)
 			sc.w.Print(" ", c.Op.String(), " ")
 			sc.visitExp(c.Right)
+			if c.Escape != "" {
+				if len([]rune(c.Escape)) != 1 {
+					sc.throw("escape of like should be a single character:" + c.Escape)
+				}
+				sc.w.Print(" ", ansi.Escape, " ")
+				sc.writeValue(c.Escape)
+			}
 		}
 	}
 }
 
-func (sc *StmtCompiler) visitIn(c *Condition) {
+// visitBetween write left [NOT] BETWEEN right AND high
+func (sc *StmtCompiler) visitBetween(c *Condition) {
+	if c.High == nil {
+		sc.throw("upper bound of between is nil")
+	}
 	sc.visitExp(c.Left)
 	sc.w.Print(" ", c.Op.String(), " ")
+	sc.visitExp(c.Right)
+	sc.w.Print(" ", ansi.And, " ")
+	sc.visitExp(c.High)
+}
 
-	sc.w.OpenParentheses()
-	switch exp := c.Right.(type) {
-	case *Value:
-		if exp.Value != nil {
-			sc.visitSlice(exp.Value)
+// visitDistinct write null-safe comparison, IS [NOT] DISTINCT FROM on postgres, <=> on mysql,
+// IS [NOT] on sqlite, rewrite by IS NULL on sql server and oracle
+func (sc *StmtCompiler) visitDistinct(c *Condition) {
+	equals := c.Op == IsNotDistinct
+
+	switch sc.Dialecter.Name() {
+	case "mysql":
+		if !equals {
+			sc.w.Print(ansi.Not, " ")
+		}
+		sc.w.OpenParentheses()
+		sc.visitExp(c.Left)
+		sc.w.WriteString(" <=> ")
+		sc.visitExp(c.Right)
+		sc.w.CloseParentheses()
+	case "sqlite":
+		sc.visitExp(c.Left)
+		if equals {
+			sc.w.Print(" ", ansi.Is, " ")
+		} else {
+			sc.w.Print(" ", ansi.IsNot, " ")
+		}
+		sc.visitExp(c.Right)
+	case "mssql", "oracle":
+		sc.w.OpenParentheses()
+		if equals {
+			// a = b OR (a IS NULL AND b IS NULL)
+			sc.visitExp(c.Left)
+			sc.w.Print(" ", ansi.Equals, " ")
+			sc.visitExp(c.Right)
+			sc.w.Print(" ", ansi.Or, " (")
+			sc.visitExp(c.Left)
+			sc.w.Print(" ", ansi.IsNull, " ", ansi.And, " ")
+			sc.visitExp(c.Right)
+			sc.w.Print(" ", ansi.IsNull, ")")
+		} else {
+			// a <> b OR (a IS NULL AND b IS NOT NULL) OR (a IS NOT NULL AND b IS NULL)
+			sc.visitExp(c.Left)
+			sc.w.Print(" ", ansi.NotEquals, " ")
+			sc.visitExp(c.Right)
+			sc.w.Print(" ", ansi.Or, " (")
+			sc.visitExp(c.Left)
+			sc.w.Print(" ", ansi.IsNull, " ", ansi.And, " ")
+			sc.visitExp(c.Right)
+			sc.w.Print(" ", ansi.IsNotNull, ") ", ansi.Or, " (")
+			sc.visitExp(c.Left)
+			sc.w.Print(" ", ansi.IsNotNull, " ", ansi.And, " ")
+			sc.visitExp(c.Right)
+			sc.w.Print(" ", ansi.IsNull, ")")
 		}
+		sc.w.CloseParentheses()
 	default:
-		sc.visitExp(exp)
+		sc.visitExp(c.Left)
+		sc.w.Print(" ", c.Op.String(), " ")
+		sc.visitExp(c.Right)
 	}
-
-	sc.w.CloseParentheses()
+}
+
+func (sc *StmtCompiler) visitIn(c *Condition) {
+	sc.visitExp(c.Left)
+	sc.w.Print(" ", c.Op.String(), " ")
+
+	if isSubQuery(c.Right) {
+		sc.visitSubQuery(c.Right)
+		return
+	}
+
+	sc.w.OpenParentheses()
+	switch exp := c.Right.(type) {
+	case *Value:
+		if exp.Value != nil {
+			sc.visitSlice(exp.Value)
+		}
+	default:
+		sc.visitExp(exp)
+	}
+
+	sc.w.CloseParentheses()
 }
 
 func (sc *StmtCompiler) visitSlice(v interface{}) {
@@ -1379,6 +1856,12 @@ func (sc *StmtCompiler) visitFrom(f *From) {
 	}
 
 	sc.w.Print("\n", ansi.From, " ")
+	sc.visitFromItems(f)
+	sc.w.Blank()
+}
+
+// visitFromItems write tables and joins of from clause
+func (sc *StmtCompiler) visitFromItems(f *From) {
 	split := false
 
 	if f.Table != nil {
@@ -1398,7 +1881,10 @@ func (sc *StmtCompiler) visitFrom(f *From) {
 		sc.w.LineBreak()
 		sc.visitJoin(f.Joins[i])
 	}
-	sc.w.Blank()
+}
+
+func hasFrom(f *From) bool {
+	return f != nil && (f.Table != nil || len(f.Tables) > 0 || len(f.Joins) > 0)
 }
 
 func (sc *StmtCompiler) visitWhere(where *Where) {
@@ -1492,6 +1978,11 @@ func (sc *StmtCompiler) visitOrderBy(orderBy *OrderBy) {
 	sc.w.LineBreak()
 	sc.w.WriteString(ansi.OrderBy)
 	sc.w.Blank()
+	sc.visitOrderByFields(orderBy)
+}
+
+func (sc *StmtCompiler) visitOrderByFields(orderBy *OrderBy) {
+	l := len(orderBy.Fields)
 	split := false
 
 	for i := 0; i < l; i++ {
@@ -1509,13 +2000,153 @@ func (sc *StmtCompiler) visitOrderBy(orderBy *OrderBy) {
 
 func (sc *StmtCompiler) visitQuery(exp Expression) {
 	query, _ := exp.(*Query)
+	sc.visitWith(query.With)
+
+	sc.checkLock(query)
+	if sc.Dialecter.Name() == "mssql" {
+		outer := sc.tableLock
+		sc.tableLock = query.Lock
+		defer func() { sc.tableLock = outer }()
+	}
+
+	if query.Offset <= 0 && query.Count <= 0 {
+		sc.visitQueryBody(query, 0)
+		sc.visitLock(query.Lock)
+		sc.visitEndStatement()
+		return
+	}
+
+	switch sc.Dialecter.Name() {
+	case "postgres", "sqlite":
+		sc.visitQueryBody(query, 0)
+		sc.w.LineBreak()
+		sc.visitLimitOffset(query.Offset, query.Count)
+	case "mssql":
+		if query.IsDistinct && !hasOrderBy(query.OrderBy) {
+			sc.throw("sql server requires order by to page distinct query")
+		}
+		version := dialectVersion(sc.Dialecter)
+		if version == 0 || version >= 11 {
+			sc.visitQueryBody(query, 0)
+			if !hasOrderBy(query.OrderBy) {
+				// OFFSET ... FETCH requires ORDER BY
+				sc.w.LineBreak()
+				sc.w.Print(ansi.OrderBy, " (", ansi.Select, " ", ansi.Null, ")")
+			}
+			sc.w.LineBreak()
+			sc.visitOffsetFetch(query.Offset, query.Count)
+		} else if query.Offset <= 0 {
+			sc.visitQueryBody(query, query.Count)
+		} else {
+			sc.visitRowNumberQuery(query)
+		}
+	case "oracle":
+		version := dialectVersion(sc.Dialecter)
+		if version == 0 || version >= 12 {
+			sc.visitQueryBody(query, 0)
+			sc.w.LineBreak()
+			sc.visitOffsetFetch(query.Offset, query.Count)
+		} else {
+			sc.visitRownumQuery(query.Select, query.Offset, query.Count, func() { sc.visitQueryBody(query, 0) })
+		}
+	default:
+		sc.visitQueryBody(query, 0)
+		sc.w.LineBreak()
+		sc.visitLimitComma(query.Offset, query.Count)
+	}
+	sc.visitLock(query.Lock)
+	sc.visitEndStatement()
+}
+
+// checkLock throw error if dialect doesn't support lock of query
+func (sc *StmtCompiler) checkLock(q *Query) {
+	l := q.Lock
+	if l == nil {
+		return
+	}
+	if l.Mode != ForUpdate && l.Mode != ForShare {
+		sc.throw("doesn't support lock mode:" + l.Mode.String())
+	}
+	if l.Wait != Wait && l.Wait != NoWait && l.Wait != SkipLocked {
+		sc.throw("doesn't support lock wait:" + l.Wait.String())
+	}
+
+	switch sc.Dialecter.Name() {
+	case "sqlite":
+		sc.throw("sqlite doesn't support row lock")
+	case "oracle":
+		if l.Mode == ForShare {
+			sc.throw("oracle doesn't support lock mode:" + l.Mode.String())
+		}
+		if q.Offset > 0 || q.Count > 0 {
+			sc.throw("oracle doesn't support row lock with limit")
+		}
+		if len(l.Of) > 0 {
+			// oracle FOR UPDATE OF takes columns, not tables
+			sc.throw("oracle doesn't support lock of tables")
+		}
+	case "mysql":
+		if version := dialectVersion(sc.Dialecter); version > 0 && version < 8 && (l.Wait != Wait || len(l.Of) > 0) {
+			sc.throw("mysql before 8.0 doesn't support lock wait or lock of tables")
+		}
+	}
+}
+
+// visitLock write FOR UPDATE|FOR SHARE [OF tables] [NOWAIT|SKIP LOCKED], sql server uses table hints
+func (sc *StmtCompiler) visitLock(l *Lock) {
+	if l == nil || sc.Dialecter.Name() == "mssql" {
+		return
+	}
+
+	sc.w.LineBreak()
+	if version := dialectVersion(sc.Dialecter); l.Mode == ForShare && sc.Dialecter.Name() == "mysql" && version > 0 && version < 8 {
+		sc.w.WriteString("LOCK IN SHARE MODE")
+		return
+	}
 
+	sc.w.WriteString(l.Mode.String())
+	if len(l.Of) > 0 {
+		sc.w.Print(" ", ansi.Of, " ")
+		for i := 0; i < len(l.Of); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.writeIdentifier(l.Of[i])
+		}
+	}
+	if l.Wait != Wait {
+		sc.w.Print(" ", l.Wait.String())
+	}
+}
+
+// writeTableHint write WITH (UPDLOCK, ROWLOCK, READPAST) of sql server
+func (sc *StmtCompiler) writeTableHint(l *Lock) {
+	sc.w.Print(" ", ansi.With, " (")
+	if l.Mode == ForShare {
+		sc.w.WriteString("REPEATABLEREAD, ROWLOCK")
+	} else {
+		sc.w.WriteString("UPDLOCK, ROWLOCK")
+	}
+	switch l.Wait {
+	case NoWait:
+		sc.w.WriteString(", NOWAIT")
+	case SkipLocked:
+		sc.w.WriteString(", READPAST")
+	}
+	sc.w.CloseParentheses()
+}
+
+// visitQueryBody write select statement without limit, top > 0 means SELECT TOP (top)
+func (sc *StmtCompiler) visitQueryBody(query *Query, top int) {
 	sc.w.WriteString(ansi.Select)
 	sc.w.Blank()
 	if query.IsDistinct {
 		sc.w.WriteString(ansi.Distinct)
 		sc.w.Blank()
 	}
+	if top > 0 {
+		sc.w.Print(ansi.Top, " (", strconv.Itoa(top), ") ")
+	}
 
 	sc.visitSelect(query.Select)
 	sc.visitFrom(query.From)
@@ -1525,23 +2156,515 @@ func (sc *StmtCompiler) visitQuery(exp Expression) {
 		sc.visitHaving(query.Having)
 	}
 	sc.visitOrderBy(query.OrderBy)
+}
+
+// visitLimitOffset write LIMIT count OFFSET offset
+func (sc *StmtCompiler) visitLimitOffset(offset, count int) {
+	if count > 0 {
+		sc.w.Print(ansi.Limit, " ", strconv.Itoa(count))
+	} else if sc.Dialecter.Name() == "sqlite" {
+		// sqlite doesn't support offset without limit
+		sc.w.Print(ansi.Limit, " -1")
+	}
+	if offset > 0 {
+		if count > 0 || sc.Dialecter.Name() == "sqlite" {
+			sc.w.Blank()
+		}
+		sc.w.Print(ansi.Offset, " ", strconv.Itoa(offset))
+	}
+}
+
+// visitLimitComma write LIMIT offset,count
+func (sc *StmtCompiler) visitLimitComma(offset, count int) {
+	limit := strconv.Itoa(count)
+	if count <= 0 {
+		// mysql doesn't support offset without limit
+		limit = "18446744073709551615"
+	}
+	sc.w.Print(ansi.Limit, " ", strconv.Itoa(offset), ",", limit)
+}
+
+// visitOffsetFetch write OFFSET offset ROWS FETCH NEXT count ROWS ONLY
+func (sc *StmtCompiler) visitOffsetFetch(offset, count int) {
+	if offset > 0 || sc.Dialecter.Name() == "mssql" {
+		// sql server requires OFFSET before FETCH
+		sc.w.Print(ansi.Offset, " ", strconv.Itoa(offset), " ROWS ")
+	}
+	if count > 0 {
+		if offset > 0 || sc.Dialecter.Name() == "mssql" {
+			sc.w.Print(ansi.Fetch, " NEXT ", strconv.Itoa(count), " ROWS ONLY")
+		} else {
+			sc.w.Print(ansi.Fetch, " FIRST ", strconv.Itoa(count), " ROWS ONLY")
+		}
+	}
+}
+
+// visitRowNumberQuery write paging query by ROW_NUMBER() for sql server before 2012, outer select projects
+// columns of query without row number. distinct query is numbered in a derived table, so DISTINCT applies before numbering
+func (sc *StmtCompiler) visitRowNumberQuery(query *Query) {
+	sc.w.WriteString(ansi.Select)
+	sc.w.Blank()
+	columns := sc.visitPagingColumns(query.Select)
+	sc.w.Print(" ", ansi.From, " (")
+	sc.w.LineBreak()
+
+	if query.IsDistinct {
+		sc.w.Print(ansi.Select, " ", _pagingTable, ".*, ROW_NUMBER() OVER (", ansi.OrderBy, " ")
+		for i := 0; i < len(query.OrderBy.Fields); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			item := query.OrderBy.Fields[i]
+			j := sc.pagingOrderColumn(query.Select, columns, item.Exp)
+			sc.writePagingColumn(query.Select.Fields[j], columns[j])
+			sc.w.Print(" ", item.Direction.String())
+		}
+		sc.w.Print(") ", ansi.As, " ", _rowNumberColumn, " ", ansi.From, " (")
+		sc.w.LineBreak()
+
+		body := *query
+		body.OrderBy = nil
+		sc.visitQueryBody(&body, 0)
 
-	// limit, mssql doesn't support limit, need change to select * from (ROW_NUMBER(),...) where ...
-	if query.Offset > 0 || query.Count > 0 {
 		sc.w.LineBreak()
-		sc.w.Print(ansi.Limit, " ", strconv.Itoa(query.Offset), ",", strconv.Itoa(query.Count))
+		sc.w.Print(") ", ansi.As, " ", _pagingTable)
+	} else {
+		sc.w.WriteString(ansi.Select)
+		sc.w.Blank()
+		sc.visitSelect(query.Select)
+		sc.w.Print(", ROW_NUMBER() OVER (", ansi.OrderBy, " ")
+		if hasOrderBy(query.OrderBy) {
+			sc.visitOrderByFields(query.OrderBy)
+		} else {
+			sc.w.Print("(", ansi.Select, " ", ansi.Null, ")")
+		}
+		sc.w.Print(") ", ansi.As, " ", _rowNumberColumn)
+
+		sc.visitFrom(query.From)
+		sc.visitWhere(query.Where)
+		sc.visitGroupBy(query.GroupBy)
+		if query.GroupBy != nil && len(query.GroupBy.Fields) > 0 {
+			sc.visitHaving(query.Having)
+		}
+	}
+
+	sc.w.LineBreak()
+	sc.w.Print(") ", ansi.As, " ", _pagingTable)
+	sc.w.LineBreak()
+	sc.w.Print(ansi.Where, " ", _rowNumberColumn, " > ", strconv.Itoa(query.Offset))
+	if query.Count > 0 {
+		sc.w.Print(" ", ansi.And, " ", _rowNumberColumn, " <= ", strconv.Itoa(query.Offset+query.Count))
+	}
+	sc.w.LineBreak()
+	sc.w.Print(ansi.OrderBy, " ", _rowNumberColumn)
+}
+
+// visitPagingColumns write output columns of select in outer query of paging, so row number column isn't returned
+func (sc *StmtCompiler) visitPagingColumns(slt *Select) []string {
+	columns := sc.pagingColumns(slt)
+	for i := 0; i < len(columns); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.writePagingColumn(slt.Fields[i], columns[i])
+	}
+	return columns
+}
+
+// pagingColumns return output column names of select, field should be column or has alias
+func (sc *StmtCompiler) pagingColumns(slt *Select) []string {
+	if slt == nil || len(slt.Fields) == 0 {
+		sc.throw("paging by row number requires columns of select")
+	}
+
+	columns := make([]string, 0, len(slt.Fields))
+	for i := 0; i < len(slt.Fields); i++ {
+		f := slt.Fields[i]
+		if f.Alias != "" {
+			columns = append(columns, f.Alias)
+			continue
+		}
+		c, ok := f.Exp.(Column)
+		if _, name := c.Split(); ok && name != ansi.WildcardAll {
+			columns = append(columns, name)
+			continue
+		}
+		sc.throw(fmt.Sprintf("paging by row number requires column or alias of field:%v", f.Exp))
+	}
+	return columns
+}
+
+// writePagingColumn write output column of field, alias is quoted as select does
+func (sc *StmtCompiler) writePagingColumn(f *Field, name string) {
+	if f.Alias != "" {
+		sc.writeQuote(name)
+	} else {
+		sc.visitColumn(Column(name))
+	}
+}
+
+// pagingOrderColumn return index of output column of select that order by exp refers to
+func (sc *StmtCompiler) pagingOrderColumn(slt *Select, columns []string, exp Expression) int {
+	for i := 0; i < len(slt.Fields); i++ {
+		if reflect.DeepEqual(slt.Fields[i].Exp, exp) {
+			return i
+		}
+	}
+	if c, ok := exp.(Column); ok {
+		_, name := c.Split()
+		for i := 0; i < len(columns); i++ {
+			if strings.EqualFold(columns[i], name) {
+				return i
+			}
+		}
+	}
+	sc.throw(fmt.Sprintf("order by of distinct query should be selected column:%v", exp))
+	return -1
+}
+
+// visitRownumQuery write paging query by ROWNUM for oracle before 12c, body writes the inner query,
+// outer select projects columns of slt without row number if offset is set
+func (sc *StmtCompiler) visitRownumQuery(slt *Select, offset, count int, body func()) {
+	if offset <= 0 {
+		sc.w.Print(ansi.Select, " ", ansi.WildcardAll, " ", ansi.From, " (")
+		sc.w.LineBreak()
+		body()
+		sc.w.LineBreak()
+		sc.w.Print(") ", ansi.Where, " ROWNUM <= ", strconv.Itoa(count))
+		return
+	}
+
+	sc.w.WriteString(ansi.Select)
+	sc.w.Blank()
+	sc.visitPagingColumns(slt)
+	sc.w.Print(" ", ansi.From, " (")
+	sc.w.Print(ansi.Select, " ", _pagingTable, ".*, ROWNUM ", _rowNumberColumn, " ", ansi.From, " (")
+	sc.w.LineBreak()
+	body()
+	sc.w.LineBreak()
+	sc.w.Print(") ", _pagingTable)
+	if count > 0 {
+		sc.w.Print(" ", ansi.Where, " ROWNUM <= ", strconv.Itoa(offset+count))
+	}
+	sc.w.Print(") ", ansi.Where, " ", _rowNumberColumn, " > ", strconv.Itoa(offset))
+}
+
+// visitCompound write queries combined by set operators, then order by and paging of the result
+func (sc *StmtCompiler) visitCompound(c *Compound) {
+	if c == nil || c.Query == nil {
+		sc.throw("query of compound is nil")
+	}
+	sc.visitWith(c.With)
+
+	if c.Offset <= 0 && c.Count <= 0 {
+		sc.visitCompoundBody(c)
+		sc.visitOrderBy(c.OrderBy)
+		sc.visitEndStatement()
+		return
+	}
+
+	switch sc.Dialecter.Name() {
+	case "postgres", "sqlite":
+		sc.visitCompoundBody(c)
+		sc.visitOrderBy(c.OrderBy)
+		sc.w.LineBreak()
+		sc.visitLimitOffset(c.Offset, c.Count)
+	case "mssql":
+		version := dialectVersion(sc.Dialecter)
+		if version == 0 || version >= 11 {
+			sc.visitCompoundBody(c)
+			if hasOrderBy(c.OrderBy) {
+				sc.visitOrderBy(c.OrderBy)
+			} else {
+				sc.w.LineBreak()
+				sc.w.Print(ansi.OrderBy, " (", ansi.Select, " ", ansi.Null, ")")
+			}
+			sc.w.LineBreak()
+			sc.visitOffsetFetch(c.Offset, c.Count)
+		} else {
+			sc.visitRowNumberCompound(c)
+		}
+	case "oracle":
+		version := dialectVersion(sc.Dialecter)
+		if version == 0 || version >= 12 {
+			sc.visitCompoundBody(c)
+			sc.visitOrderBy(c.OrderBy)
+			sc.w.LineBreak()
+			sc.visitOffsetFetch(c.Offset, c.Count)
+		} else {
+			sc.visitRownumQuery(c.Query.Select, c.Offset, c.Count, func() {
+				sc.visitCompoundBody(c)
+				sc.visitOrderBy(c.OrderBy)
+			})
+		}
+	default:
+		sc.visitCompoundBody(c)
+		sc.visitOrderBy(c.OrderBy)
+		sc.w.LineBreak()
+		sc.visitLimitComma(c.Offset, c.Count)
 	}
 	sc.visitEndStatement()
 }
 
+// visitCompoundBody write queries combined by set operators, without order by and paging
+func (sc *StmtCompiler) visitCompoundBody(c *Compound) {
+	sc.visitCompoundQuery(c.Query)
+	for i := 0; i < len(c.Queries); i++ {
+		cq := c.Queries[i]
+		if cq == nil || cq.Query == nil {
+			sc.throw("query of compound is nil")
+		}
+		sc.w.LineBreak()
+		sc.w.WriteString(sc.setOperator(cq.Operator))
+		sc.w.LineBreak()
+		sc.visitCompoundQuery(cq.Query)
+	}
+}
+
+// visitCompoundQuery write a query of compound, query with order by or limit is enclosed in parentheses
+func (sc *StmtCompiler) visitCompoundQuery(q *Query) {
+	if !hasOrderBy(q.OrderBy) && q.Offset <= 0 && q.Count <= 0 {
+		sc.visitQueryBody(q, 0)
+		return
+	}
+
+	if sc.Dialecter.Name() == "sqlite" {
+		sc.throw("sqlite doesn't support order by or limit in query of compound")
+	}
+	sc.visitSubQuery(q)
+}
+
+// setOperator return sql of set operator, throw error if dialect doesn't support it
+func (sc *StmtCompiler) setOperator(op SetOperator) string {
+	switch op {
+	case Union, UnionAll:
+		return op.String()
+	case Intersect, Except:
+		switch sc.Dialecter.Name() {
+		case "mysql":
+			if version := dialectVersion(sc.Dialecter); version > 0 && version < 8 {
+				sc.throw("mysql before 8.0 doesn't support set operator:" + op.String())
+			}
+		case "oracle":
+			if op == Except {
+				return ansi.Minus
+			}
+		}
+		return op.String()
+	}
+
+	sc.throw("doesn't support set operator:" + op.String())
+	return ""
+}
+
+// visitRowNumberCompound write paging compound query by ROW_NUMBER() for sql server before 2012,
+// outer select projects columns of first query without row number
+func (sc *StmtCompiler) visitRowNumberCompound(c *Compound) {
+	sc.w.WriteString(ansi.Select)
+	sc.w.Blank()
+	sc.visitPagingColumns(c.Query.Select)
+	sc.w.Print(" ", ansi.From, " (")
+	sc.w.Print(ansi.Select, " ", _pagingTable, ".*, ROW_NUMBER() OVER (", ansi.OrderBy, " ")
+	if hasOrderBy(c.OrderBy) {
+		sc.visitOrderByFields(c.OrderBy)
+	} else {
+		sc.w.Print("(", ansi.Select, " ", ansi.Null, ")")
+	}
+	sc.w.Print(") ", ansi.As, " ", _rowNumberColumn, " ", ansi.From, " (")
+	sc.w.LineBreak()
+	sc.visitCompoundBody(c)
+	sc.w.LineBreak()
+	sc.w.Print(") ", ansi.As, " ", _pagingTable, ") ", ansi.As, " ", _pagingTable)
+	sc.w.LineBreak()
+	sc.w.Print(ansi.Where, " ", _rowNumberColumn, " > ", strconv.Itoa(c.Offset))
+	if c.Count > 0 {
+		sc.w.Print(" ", ansi.And, " ", _rowNumberColumn, " <= ", strconv.Itoa(c.Offset+c.Count))
+	}
+	sc.w.LineBreak()
+	sc.w.Print(ansi.OrderBy, " ", _rowNumberColumn)
+}
+
+const (
+	_rowNumberColumn = "kdb_rownum"
+	_pagingTable     = "kdb_t"
+)
+
+func hasOrderBy(orderBy *OrderBy) bool {
+	return orderBy != nil && len(orderBy.Fields) > 0
+}
+
+// isWindowFunc return true if name is one of funcs, case-insensitive
+func isWindowFunc(name Func, funcs ...Func) bool {
+	for _, f := range funcs {
+		if strings.EqualFold(string(name), string(f)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOffsetBound return true if b is n PRECEDING or n FOLLOWING
+func isOffsetBound(b FrameBound) bool {
+	return b != "" && b != UnboundedPreceding && b != UnboundedFollowing && b != CurrentRow
+}
+
+// maxParameters return max count of bind parameters in one statement
+func maxParameters(d Dialecter) int {
+	switch d.Name() {
+	case "mssql":
+		// 2100 in total, keep headroom for parameters used by driver
+		return 2098
+	case "postgres", "mysql", "oracle":
+		return 65535
+	}
+	// sqlite before 3.32
+	return 999
+}
+
+// maxInsertRows return max count of rows in one insert statement, 0 means no limit
+func maxInsertRows(d Dialecter) int {
+	if d.Name() == "mssql" {
+		return 1000
+	}
+	return 0
+}
+
+// dialectVersion return major version of dialecter, 0 means latest
+func dialectVersion(d Dialecter) int {
+	switch d := d.(type) {
+	case MysqlDialecter:
+		return d.Version
+	case MssqlDialecter:
+		return d.Version
+	case OracleSQLDialecter:
+		return d.Version
+	}
+	return 0
+}
+
+// visitLimitCount write limit of update or delete, throw error if dialect doesn't support it
+func (sc *StmtCompiler) visitLimitCount(stmt string, count int, orderBy *OrderBy) {
+	if count <= 0 {
+		return
+	}
+
+	switch sc.Dialecter.Name() {
+	case "postgres":
+		sc.throw("postgres doesn't support limit in " + stmt)
+	case "mssql", "oracle":
+		// mssql writes TOP, oracle writes ROWNUM in where
+		if hasOrderBy(orderBy) {
+			sc.throw(sc.Dialecter.Name() + " doesn't support order by with limit in " + stmt)
+		}
+	default:
+		sc.w.LineBreak()
+		sc.w.PrintSplit(" ", ansi.Limit, strconv.Itoa(count))
+	}
+}
+
+// visitLimitWhere write where of update or delete, oracle's limit is written as ROWNUM condition
+func (sc *StmtCompiler) visitLimitWhere(where *Where, count int) {
+	if count <= 0 || sc.Dialecter.Name() != "oracle" {
+		sc.visitWhere(where)
+		return
+	}
+
+	sc.w.Print("\n", ansi.Where, "\n")
+	if where != nil && !where.isEmpty() {
+		sc.w.WriteString("(")
+		sc.visitConditions(where.Conditions)
+		sc.w.Print(") ", ansi.And, " ")
+	}
+	sc.w.Print("ROWNUM <= ", strconv.Itoa(count), " ")
+}
+
+// topOf return TOP (count) for sql server update and delete
+func (sc *StmtCompiler) topOf(count int) string {
+	if count <= 0 || sc.Dialecter.Name() != "mssql" {
+		return ""
+	}
+	return ansi.Top + " (" + strconv.Itoa(count) + ")"
+}
+
 func (sc *StmtCompiler) visitInsert(exp Expression) {
 	insert, _ := exp.(*Insert)
 
-	sc.w.Print(ansi.InsertInto, ansi.Blank, insert.Table.Name)
-
 	l := len(insert.Sets)
+	for i := 0; i < len(insert.Rows); i++ {
+		if len(insert.Rows[i]) != l {
+			sc.throw("count of values doesn't match columns in insert row:" + strconv.Itoa(i+1))
+		}
+	}
+
+	if insert.Query != nil {
+		sc.visitInsertSelect(insert)
+		return
+	}
+
+	if len(insert.Rows) > 0 && sc.Dialecter.Name() == "oracle" {
+		sc.visitOracleInsertAll(insert)
+		return
+	}
+
+	sc.w.Print(ansi.InsertInto, ansi.Blank)
+	sc.writeIdentifier(insert.Table.Name)
+	sc.visitInsertColumns(insert)
+	sc.visitOutput(insert.Output, ansi.Inserted)
+
+	sc.w.LineBreak()
+	sc.w.WriteString(ansi.Values)
+	sc.visitInsertValues(insert.Sets, nil)
+	for i := 0; i < len(insert.Rows); i++ {
+		sc.w.Comma()
+		sc.w.LineBreak()
+		sc.visitInsertValues(nil, insert.Rows[i])
+	}
+	sc.visitReturning(insert.Output)
+	sc.visitEndStatement()
+}
+
+// visitInsertSelect write INSERT INTO table (columns) SELECT ...
+func (sc *StmtCompiler) visitInsertSelect(insert *Insert) {
+	if !isSubQuery(insert.Query) {
+		sc.throw("query of insert should be *Query or *Compound")
+	}
+	if len(insert.Sets) > 0 || len(insert.Rows) > 0 {
+		sc.throw("insert from query doesn't support values:" + insert.Table.Name)
+	}
+	if !insert.Output.isEmpty() && sc.Dialecter.Name() == "oracle" {
+		sc.throw("oracle doesn't support returning of insert from query")
+	}
+
+	sc.w.Print(ansi.InsertInto, ansi.Blank)
+	sc.writeIdentifier(insert.Table.Name)
+	if len(insert.Columns) > 0 {
+		sc.w.OpenParentheses()
+		for i := 0; i < len(insert.Columns); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.visitColumn(insert.Columns[i])
+		}
+		sc.w.CloseParentheses()
+	}
+	sc.visitOutput(insert.Output, ansi.Inserted)
+
+	sc.w.LineBreak()
+	sc.depth++
+	switch q := insert.Query.(type) {
+	case *Query:
+		sc.visitQuery(q)
+	case *Compound:
+		sc.visitCompound(q)
+	}
+	sc.depth--
+	sc.visitReturning(insert.Output)
+	sc.visitEndStatement()
+}
+
+func (sc *StmtCompiler) visitInsertColumns(insert *Insert) {
 	sc.w.OpenParentheses()
-	for i := 0; i < l; i++ {
+	for i := 0; i < len(insert.Sets); i++ {
 		if i > 0 {
 			sc.w.Comma()
 		}
@@ -1550,26 +2673,81 @@ func (sc *StmtCompiler) visitInsert(exp Expression) {
 		sc.visitColumn(set.Column)
 	}
 	sc.w.CloseParentheses()
+}
 
-	sc.w.LineBreak()
-	sc.w.WriteString(ansi.Values)
+// visitInsertValues write (value, ...) of sets or row
+func (sc *StmtCompiler) visitInsertValues(sets []*Set, row []Expression) {
 	sc.w.OpenParentheses()
-	for i := 0; i < l; i++ {
+	for i := 0; i < len(sets); i++ {
 		if i > 0 {
 			sc.w.Comma()
 		}
-
-		set := insert.Sets[i]
-		sc.visitExp(set.Value)
+		sc.visitExp(sets[i].Value)
+	}
+	for i := 0; i < len(row); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitExp(row[i])
 	}
 	sc.w.CloseParentheses()
+}
+
+// visitOracleInsertAll write INSERT ALL INTO table (...) VALUES (...) ... SELECT 1 FROM DUAL
+func (sc *StmtCompiler) visitOracleInsertAll(insert *Insert) {
+	if !insert.Output.isEmpty() {
+		sc.throw("oracle doesn't support returning in multi-row insert")
+	}
+
+	sc.w.Print(ansi.Insert, " ", ansi.All)
+	for i := -1; i < len(insert.Rows); i++ {
+		sc.w.LineBreak()
+		sc.w.Print(ansi.Into, " ")
+		sc.writeIdentifier(insert.Table.Name)
+		sc.visitInsertColumns(insert)
+		sc.w.Print(" ", ansi.Values)
+		if i < 0 {
+			sc.visitInsertValues(insert.Sets, nil)
+		} else {
+			sc.visitInsertValues(nil, insert.Rows[i])
+		}
+	}
+	sc.w.LineBreak()
+	sc.w.Print(ansi.Select, " 1 ", ansi.From, " DUAL")
 	sc.visitEndStatement()
 }
 
 func (sc *StmtCompiler) visitUpdate(exp Expression) {
 	u, _ := exp.(*Update)
+	sc.visitDmlWith(u.With)
+
+	name := sc.Dialecter.Name()
+	join := hasFrom(u.From)
+	if join {
+		sc.checkJoinDml("update", u.Count, u.OrderBy)
+	}
 
-	sc.w.PrintSplit(ansi.Blank, ansi.Update, u.Table.Name, ansi.Set, ansi.LineBreak)
+	sc.w.WriteString(ansi.Update)
+	if top := sc.topOf(u.Count); top != "" {
+		sc.w.Print(" ", top)
+	}
+	sc.w.Blank()
+	switch {
+	case join && name == "mysql":
+		// UPDATE t AS a, t2 AS b SET ...
+		sc.visitTable(u.Table)
+		sc.w.Comma()
+		sc.visitFromItems(u.From)
+	case join && name == "mssql" && u.Table.Alias != "":
+		// UPDATE a SET ... FROM t AS a, t2 AS b
+		sc.writeIdentifier(u.Table.Alias)
+	case join:
+		// UPDATE t AS a SET ... FROM t2 AS b
+		sc.visitTable(u.Table)
+	default:
+		sc.writeIdentifier(u.Table.Name)
+	}
+	sc.w.PrintSplit(ansi.Blank, "", ansi.Set, ansi.LineBreak)
 	l := len(u.Sets)
 	for i := 0; i < l; i++ {
 		if i > 0 {
@@ -1577,34 +2755,373 @@ func (sc *StmtCompiler) visitUpdate(exp Expression) {
 		}
 
 		set := u.Sets[i]
-		sc.visitColumn(set.Column)
+		if join && name != "mysql" && name != "mssql" {
+			// postgres and sqlite don't allow qualified column in SET
+			_, column := set.Column.Split()
+			sc.visitColumn(Column(column))
+		} else {
+			sc.visitColumn(set.Column)
+		}
 		sc.w.WriteString(ansi.Equals)
 		sc.visitExp(set.Value)
 	}
-	sc.visitWhere(u.Where)
-	sc.visitOrderBy(u.OrderBy)
-	if u.Count > 0 {
-		sc.w.LineBreak()
-		sc.w.PrintSplit(" ", ansi.Limit, strconv.Itoa(u.Count))
+	sc.visitOutput(u.Output, ansi.Inserted)
+	if join && name != "mysql" {
+		sc.w.Print("\n", ansi.From, " ")
+		if name == "mssql" && u.Table.Alias != "" {
+			sc.visitTable(u.Table)
+			sc.w.Comma()
+		}
+		sc.visitFromItems(u.From)
+		sc.w.Blank()
 	}
+	sc.visitLimitWhere(u.Where, u.Count)
+	sc.visitReturning(u.Output)
+	sc.visitOrderBy(u.OrderBy)
+	sc.visitLimitCount("update", u.Count, u.OrderBy)
 	sc.visitEndStatement()
 
 }
 
 func (sc *StmtCompiler) visitDelete(exp Expression) {
 	d, _ := exp.(*Delete)
+	sc.visitDmlWith(d.With)
 
-	sc.w.PrintSplit(ansi.Blank, ansi.Delete, ansi.From, d.Table.Name)
-	sc.visitWhere(d.Where)
+	name := sc.Dialecter.Name()
+	join := hasFrom(d.From)
+	if join {
+		sc.checkJoinDml("delete", d.Count, d.OrderBy)
+	}
+
+	sc.w.WriteString(ansi.Delete)
+	if top := sc.topOf(d.Count); top != "" {
+		sc.w.Print(" ", top)
+	}
+	switch {
+	case join && name == "postgres":
+		// DELETE FROM t AS a USING t2 AS b
+		sc.w.PrintSplit(ansi.Blank, "", ansi.From, "")
+		sc.visitTable(d.Table)
+		sc.w.Print("\n", ansi.Using, " ")
+		sc.visitFromItems(d.From)
+		sc.w.Blank()
+	case join:
+		// DELETE a FROM t AS a, t2 AS b
+		sc.w.Blank()
+		if d.Table.Alias != "" {
+			sc.writeIdentifier(d.Table.Alias)
+		} else {
+			sc.writeIdentifier(d.Table.Name)
+		}
+		sc.visitOutput(d.Output, ansi.Deleted)
+		sc.w.Print("\n", ansi.From, " ")
+		sc.visitTable(d.Table)
+		sc.w.Comma()
+		sc.visitFromItems(d.From)
+		sc.w.Blank()
+	default:
+		sc.w.PrintSplit(ansi.Blank, "", ansi.From, "")
+		sc.writeIdentifier(d.Table.Name)
+		sc.visitOutput(d.Output, ansi.Deleted)
+	}
+	sc.visitLimitWhere(d.Where, d.Count)
+	sc.visitReturning(d.Output)
 	sc.visitOrderBy(d.OrderBy)
-	if d.Count > 0 {
-		sc.w.LineBreak()
-		sc.w.PrintSplit(" ", ansi.Limit, strconv.Itoa(d.Count))
+	sc.visitLimitCount("delete", d.Count, d.OrderBy)
+	sc.visitEndStatement()
+}
+
+// checkJoinDml throw error if dialect doesn't support update or delete with other tables
+func (sc *StmtCompiler) checkJoinDml(stmt string, count int, orderBy *OrderBy) {
+	switch sc.Dialecter.Name() {
+	case "mysql":
+		if count > 0 || hasOrderBy(orderBy) {
+			sc.throw("mysql doesn't support limit or order by in multiple-table " + stmt)
+		}
+	case "postgres", "mssql":
+	case "sqlite":
+		if stmt != "update" {
+			sc.throw("sqlite doesn't support " + stmt + " with other tables")
+		}
+	default:
+		sc.throw(sc.Dialecter.Name() + " doesn't support " + stmt + " with other tables")
+	}
+}
+
+// visitWith write WITH [RECURSIVE] name (columns) AS (query), ...
+func (sc *StmtCompiler) visitWith(w *With) {
+	if w.isEmpty() {
+		return
+	}
+
+	name := sc.Dialecter.Name()
+	if version := dialectVersion(sc.Dialecter); name == "mysql" && version > 0 && version < 8 {
+		sc.throw("mysql before 8.0 doesn't support with clause")
+	}
+
+	sc.w.WriteString(ansi.With)
+	sc.w.Blank()
+	if w.Recursive && name != "mssql" && name != "oracle" {
+		sc.w.WriteString(ansi.Recursive)
+		sc.w.Blank()
+	}
+
+	for i := 0; i < len(w.Tables); i++ {
+		ct := w.Tables[i]
+		if ct == nil || ct.Name == "" || !isSubQuery(ct.Query) {
+			sc.throw("common table should have name and query")
+		}
+		if i > 0 {
+			sc.w.Comma()
+			sc.w.LineBreak()
+		}
+
+		sc.writeIdentifier(ct.Name)
+		if len(ct.Columns) > 0 {
+			sc.w.Print(" (")
+			for j := 0; j < len(ct.Columns); j++ {
+				if j > 0 {
+					sc.w.Comma()
+				}
+				sc.writeIdentifier(ct.Columns[j])
+			}
+			sc.w.Print(")")
+		} else if w.Recursive && name == "oracle" {
+			sc.throw("oracle requires columns of recursive common table:" + ct.Name)
+		}
+		sc.w.Print(" ", ansi.As, " ")
+		sc.visitSubQuery(ct.Query)
+	}
+	sc.w.LineBreak()
+}
+
+// visitDmlWith write with clause of update or delete, oracle only supports with clause in query
+func (sc *StmtCompiler) visitDmlWith(w *With) {
+	if !w.isEmpty() && sc.Dialecter.Name() == "oracle" {
+		sc.throw("oracle doesn't support with clause on update or delete")
+	}
+	sc.visitWith(w)
+}
+
+func (sc *StmtCompiler) visitUpsert(exp Expression) {
+	u, _ := exp.(*Upsert)
+
+	if len(u.Keys) == 0 {
+		sc.throw("upsert keys is empty:" + u.Table.Name)
+	}
+	for i := 0; i < len(u.Keys); i++ {
+		if !u.hasColumn(u.Keys[i]) {
+			sc.throw("upsert key isn't in sets:" + u.Keys[i].String())
+		}
+	}
+
+	switch sc.Dialecter.Name() {
+	case "postgres", "sqlite", "mysql":
+		sc.visitInsertUpsert(u)
+	default:
+		sc.visitMerge(u)
 	}
 	sc.visitEndStatement()
 }
 
+// visitInsertUpsert write INSERT ... ON CONFLICT DO UPDATE or INSERT ... ON DUPLICATE KEY UPDATE
+func (sc *StmtCompiler) visitInsertUpsert(u *Upsert) {
+	insert := &Insert{Table: u.Table, Sets: u.Sets}
+	sc.w.Print(ansi.InsertInto, ansi.Blank)
+	sc.writeIdentifier(u.Table.Name)
+	sc.visitInsertColumns(insert)
+	sc.w.LineBreak()
+	sc.w.WriteString(ansi.Values)
+	sc.visitInsertValues(u.Sets, nil)
+	sc.w.LineBreak()
+
+	updates := u.updateColumns()
+	if sc.Dialecter.Name() == "mysql" {
+		sc.w.WriteString("ON DUPLICATE KEY UPDATE ")
+		if len(updates) == 0 {
+			// no column to update, set key to itself to ignore duplicate row
+			updates = u.Keys[:1]
+		}
+		for i := 0; i < len(updates); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.visitColumn(updates[i])
+			sc.w.Print(ansi.Equals, ansi.Values, "(")
+			sc.visitColumn(updates[i])
+			sc.w.WriteString(")")
+		}
+		return
+	}
+
+	sc.w.WriteString("ON CONFLICT (")
+	for i := 0; i < len(u.Keys); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitColumn(u.Keys[i])
+	}
+	sc.w.WriteString(") DO ")
+	if len(updates) == 0 {
+		sc.w.WriteString("NOTHING")
+		return
+	}
+
+	sc.w.Print(ansi.Update, " ", ansi.Set, " ")
+	for i := 0; i < len(updates); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitColumn(updates[i])
+		sc.w.Print(ansi.Equals, "EXCLUDED", ansi.Split)
+		sc.visitColumn(updates[i])
+	}
+}
+
+// visitMerge write MERGE INTO target USING (SELECT values) source ON (keys) WHEN MATCHED ... WHEN NOT MATCHED ...
+func (sc *StmtCompiler) visitMerge(u *Upsert) {
+	as := " " + ansi.As + " "
+	if sc.Dialecter.Name() == "oracle" {
+		// oracle doesn't support AS for table alias
+		as = " "
+	}
+
+	sc.w.Print("MERGE ", ansi.Into, " ")
+	sc.writeIdentifier(u.Table.Name)
+	sc.w.Print(as, _mergeTarget)
+	sc.w.LineBreak()
+	sc.w.Print(ansi.Using, " (", ansi.Select, " ")
+	for i := 0; i < len(u.Sets); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitExp(u.Sets[i].Value)
+		sc.w.Print(" ", ansi.As, " ")
+		sc.visitColumn(u.Sets[i].Column)
+	}
+	if sc.Dialecter.Name() == "oracle" {
+		sc.w.Print(" ", ansi.From, " DUAL")
+	}
+	sc.w.Print(")", as, _mergeSource)
+
+	sc.w.LineBreak()
+	sc.w.Print(ansi.On, " (")
+	for i := 0; i < len(u.Keys); i++ {
+		if i > 0 {
+			sc.w.Print(" ", ansi.And, " ")
+		}
+		sc.visitMergeColumn(_mergeTarget, u.Keys[i])
+		sc.w.WriteString(ansi.Equals)
+		sc.visitMergeColumn(_mergeSource, u.Keys[i])
+	}
+	sc.w.WriteString(")")
+
+	updates := u.updateColumns()
+	if len(updates) > 0 {
+		sc.w.LineBreak()
+		sc.w.Print("WHEN MATCHED THEN ", ansi.Update, " ", ansi.Set, " ")
+		for i := 0; i < len(updates); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.visitMergeColumn(_mergeTarget, updates[i])
+			sc.w.WriteString(ansi.Equals)
+			sc.visitMergeColumn(_mergeSource, updates[i])
+		}
+	}
+
+	sc.w.LineBreak()
+	sc.w.Print("WHEN NOT MATCHED THEN ", ansi.Insert, " ")
+	sc.visitInsertColumns(&Insert{Sets: u.Sets})
+	sc.w.Print(" ", ansi.Values, " (")
+	for i := 0; i < len(u.Sets); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitMergeColumn(_mergeSource, u.Sets[i].Column)
+	}
+	sc.w.WriteString(")")
+}
+
+func (sc *StmtCompiler) visitMergeColumn(table string, c Column) {
+	sc.w.Print(table, ansi.Split)
+	sc.visitColumn(c)
+}
+
+const (
+	_mergeTarget = "kdb_target"
+	_mergeSource = "kdb_source"
+)
+
+// visitOutput write OUTPUT INSERTED.column or DELETED.column for sql server
+func (sc *StmtCompiler) visitOutput(o *Output, prefix string) {
+	if o.isEmpty() || sc.Dialecter.Name() != "mssql" {
+		return
+	}
+
+	sc.w.LineBreak()
+	sc.w.WriteString(ansi.Output)
+	sc.w.Blank()
+	for i := 0; i < len(o.Columns); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		if prefix != "" {
+			sc.w.Print(prefix, ansi.Split)
+		}
+		sc.visitColumn(o.Columns[i])
+	}
+	sc.w.Blank()
+}
+
+// visitReturning write RETURNING column, ..., oracle write RETURNING column, ... INTO :out, ...
+func (sc *StmtCompiler) visitReturning(o *Output) {
+	if o.isEmpty() {
+		return
+	}
+
+	switch sc.Dialecter.Name() {
+	case "mssql":
+		// written by visitOutput
+		return
+	case "mysql":
+		sc.throw("mysql doesn't support returning")
+	case "oracle":
+		for i := 0; i < len(o.Columns); i++ {
+			if _, column := o.Columns[i].Split(); column == ansi.WildcardAll {
+				sc.throw("oracle doesn't support returning *")
+			}
+		}
+	}
+
+	sc.w.LineBreak()
+	sc.w.WriteString(ansi.Returning)
+	sc.w.Blank()
+	for i := 0; i < len(o.Columns); i++ {
+		if i > 0 {
+			sc.w.Comma()
+		}
+		sc.visitColumn(o.Columns[i])
+	}
+
+	if sc.Dialecter.Name() == "oracle" {
+		// values are returned by out parameters, ExecReturning binds them to dest
+		sc.w.Print(" ", ansi.Into, " ")
+		for i := 0; i < len(o.Columns); i++ {
+			if i > 0 {
+				sc.w.Comma()
+			}
+			sc.writeValue(sql.Out{Dest: new(interface{})})
+		}
+	}
+	sc.w.Blank()
+}
+
 func (sc *StmtCompiler) visitEndStatement() {
+	if sc.depth > 0 {
+		// sub query
+		return
+	}
 	sc.w.WriteString(sc.Dialecter.SplitStatement())
 }
 
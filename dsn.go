@@ -14,6 +14,9 @@ type DSN struct {
 
 	// Source is driver-specific data source name
 	Source string
+
+	// QuoteIdentifier quote table, alias and column names when compile expression
+	QuoteIdentifier bool
 }
 
 // String
@@ -34,6 +37,11 @@ func RegisterDSN(name, driver, source string) {
 	_dsnData[name] = dsn
 }
 
+// GetDSN return a registered DSN by name
+func GetDSN(name string) (*DSN, bool) {
+	return getDSN(name)
+}
+
 func getDSN(name string) (*DSN, bool) {
 	dsn, ok := _dsnData[name]
 	return dsn, ok
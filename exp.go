@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/sdming/kdb/ansi"
+	"strconv"
 	"strings"
 )
 
@@ -95,6 +96,18 @@ const (
 	Min         Func = ansi.Min
 	Max         Func = ansi.Max
 	CurrentTime Func = "currenttime"
+	Coalesce    Func = "coalesce"
+	Lower       Func = "lower"
+	Upper       Func = "upper"
+	Substring   Func = "substring"
+	Concat      Func = "concat"
+	RowNumber   Func = "ROW_NUMBER"
+	Rank        Func = "RANK"
+	DenseRank   Func = "DENSE_RANK"
+	Lag         Func = "LAG"
+	Lead        Func = "LEAD"
+	FirstValue  Func = "FIRST_VALUE"
+	LastValue   Func = "LAST_VALUE"
 )
 
 // Operator is operator in sql
@@ -126,6 +139,10 @@ const (
 	NotEquals        Operator = ansi.NotEquals
 	Like             Operator = ansi.Like
 	NotLike          Operator = ansi.NotLike
+	Between          Operator = ansi.Between
+	NotBetween       Operator = ansi.NotBetween
+	IsDistinctFrom   Operator = ansi.IsDistinctFrom
+	IsNotDistinct    Operator = ansi.IsNotDistinct
 	In               Operator = ansi.In
 	NotIn            Operator = ansi.NotIn
 	Exists           Operator = ansi.Exists
@@ -150,6 +167,8 @@ const (
 	NodeQuery     NodeType = 4
 	NodeUpdate    NodeType = 5
 	NodeDelete    NodeType = 6
+	NodeUpsert    NodeType = 7
+	NodeCompound  NodeType = 8
 
 	NodeNull  NodeType = 11
 	NodeValue NodeType = 12
@@ -161,6 +180,9 @@ const (
 	NodeCondition NodeType = 34
 	NodeSet       NodeType = 35
 	NodeAggregate NodeType = 36
+	NodeCall      NodeType = 37
+	NodeCase      NodeType = 38
+	NodeWindow    NodeType = 39
 
 	NodeSelect  NodeType = 41
 	NodeFrom    NodeType = 42
@@ -170,6 +192,8 @@ const (
 	NodeHaving  NodeType = 46
 	NodeOrderBy NodeType = 47
 	NodeOutput  NodeType = 48
+	NodeWith    NodeType = 49
+	NodeLock    NodeType = 50
 
 	NodeOperator  = 61
 	NodeFunc      = 62
@@ -193,6 +217,10 @@ func (n NodeType) String() string {
 		return "Update"
 	case NodeDelete:
 		return "Delete"
+	case NodeUpsert:
+		return "Upsert"
+	case NodeCompound:
+		return "Compound"
 	case NodeNull:
 		return "Null"
 	case NodeValue:
@@ -211,6 +239,12 @@ func (n NodeType) String() string {
 		return "Set"
 	case NodeAggregate:
 		return "Aggregate"
+	case NodeCall:
+		return "Call"
+	case NodeCase:
+		return "Case"
+	case NodeWindow:
+		return "Window"
 	case NodeSelect:
 		return "Select"
 	case NodeFrom:
@@ -226,11 +260,17 @@ func (n NodeType) String() string {
 	case NodeOrderBy:
 		return "OrderBy"
 	case NodeOutput:
-		return "Output "
+		return "Output"
+	case NodeWith:
+		return "With"
+	case NodeLock:
+		return "Lock"
 	case NodeOperator:
 		return "Operator"
 	case NodeFunc:
 		return "Func"
+	case NodeParameter:
+		return "Parameter"
 	}
 
 	return "Unknow"
@@ -352,6 +392,12 @@ type Condition struct {
 	Right Expression
 	Left  Expression
 	Op    Operator
+
+	// High is upper bound of BETWEEN, Right is lower bound
+	High Expression
+
+	// Escape is escape character of LIKE
+	Escape string
 }
 
 // String
@@ -359,7 +405,11 @@ func (c *Condition) String() string {
 	if c == nil {
 		return _nilStr
 	}
-	if c.Right == nil && c.Left == nil {
+	if c.High != nil {
+		return fmt.Sprintf("%v %v %v %v %v", c.Left, c.Op, c.Right, ansi.And, c.High)
+	} else if c.Escape != "" {
+		return fmt.Sprintf("%v %v %v %v %v", c.Left, c.Op, c.Right, ansi.Escape, c.Escape)
+	} else if c.Right == nil && c.Left == nil {
 		return fmt.Sprint(c.Op)
 	} else if c.Left == nil {
 		return fmt.Sprint(c.Op, "(", c.Right, ")")
@@ -477,6 +527,16 @@ func (c *Conditions) CloseParentheses() *Conditions {
 	return c
 }
 
+// Merge append other conditions enclosed in parentheses, like parsed by ParseConditions
+func (c *Conditions) Merge(other *Conditions) *Conditions {
+	if other.isEmpty() {
+		return c
+	}
+	c.OpenParentheses()
+	c.Conditions = append(c.Conditions, other.Conditions...)
+	return c.CloseParentheses()
+}
+
 // Sql append raw sql
 func (c *Conditions) Sql(sqlStr string) *Conditions {
 	c.set(Sql(sqlStr))
@@ -510,6 +570,59 @@ func (c *Conditions) NotLike(column string, value string) *Conditions {
 	return c.Condition(NotLike, Column(column), &Value{Value: value})
 }
 
+// LikeEscape append LIKE value ESCAPE escape, escape should be a single character
+func (c *Conditions) LikeEscape(column string, value string, escape string) *Conditions {
+	c.set(&Condition{Op: Like, Left: Column(column), Right: &Value{Value: value}, Escape: escape})
+	return c
+}
+
+// StartsWith append LIKE 'value%', wildcards in value are escaped
+func (c *Conditions) StartsWith(column string, value string) *Conditions {
+	return c.LikeEscape(column, EscapeLike(value, LikeEscapeChar)+ansi.WildcardAny, LikeEscapeChar)
+}
+
+// EndsWith append LIKE '%value', wildcards in value are escaped
+func (c *Conditions) EndsWith(column string, value string) *Conditions {
+	return c.LikeEscape(column, ansi.WildcardAny+EscapeLike(value, LikeEscapeChar), LikeEscapeChar)
+}
+
+// Contains append LIKE '%value%', wildcards in value are escaped
+func (c *Conditions) Contains(column string, value string) *Conditions {
+	return c.LikeEscape(column, ansi.WildcardAny+EscapeLike(value, LikeEscapeChar)+ansi.WildcardAny, LikeEscapeChar)
+}
+
+// LikeEscapeChar is escape character used by StartsWith, EndsWith and Contains
+const LikeEscapeChar = "\\"
+
+// EscapeLike escape escape character and wildcards (%, _) in s
+func EscapeLike(s string, escape string) string {
+	return strings.NewReplacer(escape, escape+escape, ansi.WildcardAny, escape+ansi.WildcardAny, ansi.WildcardOne, escape+ansi.WildcardOne).Replace(s)
+}
+
+// Between append BETWEEN low AND high operation
+func (c *Conditions) Between(column string, low, high interface{}) *Conditions {
+	c.set(&Condition{Op: Between, Left: Column(column), Right: asExpression(low), High: asExpression(high)})
+	return c
+}
+
+// NotBetween append NOT BETWEEN low AND high operation
+func (c *Conditions) NotBetween(column string, low, high interface{}) *Conditions {
+	c.set(&Condition{Op: NotBetween, Left: Column(column), Right: asExpression(low), High: asExpression(high)})
+	return c
+}
+
+// NullSafeEquals append null-safe equality, true if both are NULL;
+// compiled to IS NOT DISTINCT FROM, <=> on mysql, or an equivalent rewrite
+func (c *Conditions) NullSafeEquals(column string, value interface{}) *Conditions {
+	return c.Condition(IsNotDistinct, Column(column), asExpression(value))
+}
+
+// NullSafeNotEquals append null-safe inequality, false if both are NULL;
+// compiled to IS DISTINCT FROM, NOT <=> on mysql, or an equivalent rewrite
+func (c *Conditions) NullSafeNotEquals(column string, value interface{}) *Conditions {
+	return c.Condition(IsDistinctFrom, Column(column), asExpression(value))
+}
+
 // LessOrEquals append <= operation
 func (c *Conditions) LessOrEquals(column string, value interface{}) *Conditions {
 	return c.Condition(LessOrEquals, Column(column), asExpression(value))
@@ -566,6 +679,11 @@ func newConditions() *Conditions {
 	}
 }
 
+// NewConditions return *Conditions, used to build condition of case expression
+func NewConditions() *Conditions {
+	return newConditions()
+}
+
 //Aggregate is sql aggregate Func
 type Aggregate struct {
 	Name Func
@@ -593,6 +711,222 @@ func NewAggregate(name Func, exp Expression) *Aggregate {
 	}
 }
 
+// Call is sql function call, portable functions like CurrentTime, Coalesce and Concat
+// are compiled to native function of dialect
+type Call struct {
+	Name Func
+	Args []Expression
+}
+
+// String
+func (c *Call) String() string {
+	if c == nil {
+		return _nilStr
+	}
+	return fmt.Sprint(c.Name, c.Args)
+}
+
+// Node return NodeCall
+func (c *Call) Node() NodeType {
+	return NodeCall
+}
+
+// NewCall return *Call, arg is Expression or value
+func NewCall(name Func, args ...interface{}) *Call {
+	c := &Call{Name: name, Args: make([]Expression, 0, len(args))}
+	for i := 0; i < len(args); i++ {
+		c.Args = append(c.Args, asExpression(args[i]))
+	}
+	return c
+}
+
+// CaseWhen is WHEN ... THEN ... of case expression
+type CaseWhen struct {
+	// Value is compared to Case.Exp in simple case
+	Value Expression
+
+	// Conditions is condition of searched case
+	Conditions *Conditions
+
+	// Result is value returned if Value or Conditions matched
+	Result Expression
+}
+
+// Case is CASE [Exp] WHEN ... THEN ... ELSE ... END
+type Case struct {
+	// Exp is nil for searched case
+	Exp   Expression
+	Whens []*CaseWhen
+	Else  Expression
+}
+
+// String
+func (c *Case) String() string {
+	if c == nil {
+		return _nilStr
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprint(ansi.Case, " ", c.Exp))
+	for i := 0; i < len(c.Whens); i++ {
+		w := c.Whens[i]
+		if w.Conditions != nil {
+			buf.WriteString(fmt.Sprint(" ", ansi.When, " ", w.Conditions, " ", ansi.Then, " ", w.Result))
+		} else {
+			buf.WriteString(fmt.Sprint(" ", ansi.When, " ", w.Value, " ", ansi.Then, " ", w.Result))
+		}
+	}
+	buf.WriteString(fmt.Sprint(" ", ansi.Else, " ", c.Else, " ", ansi.End))
+	return buf.String()
+}
+
+// Node return NodeCase
+func (c *Case) Node() NodeType {
+	return NodeCase
+}
+
+// When append WHEN column op value THEN result
+func (c *Case) When(op Operator, column string, value interface{}, result interface{}) *Case {
+	return c.WhenConditions(newConditions().Compare(op, column, value), result)
+}
+
+// WhenConditions append WHEN conditions THEN result
+func (c *Case) WhenConditions(conditions *Conditions, result interface{}) *Case {
+	c.Whens = append(c.Whens, &CaseWhen{Conditions: conditions, Result: asExpression(result)})
+	return c
+}
+
+// WhenValue append WHEN value THEN result of simple case
+func (c *Case) WhenValue(value interface{}, result interface{}) *Case {
+	c.Whens = append(c.Whens, &CaseWhen{Value: asExpression(value), Result: asExpression(result)})
+	return c
+}
+
+// OrElse set ELSE result
+func (c *Case) OrElse(result interface{}) *Case {
+	c.Else = asExpression(result)
+	return c
+}
+
+// NewCase return searched case, CASE WHEN conditions THEN result ... END
+func NewCase() *Case {
+	return &Case{Whens: make([]*CaseWhen, 0, _defaultCapicity)}
+}
+
+// NewSimpleCase return simple case, CASE exp WHEN value THEN result ... END
+func NewSimpleCase(exp Expression) *Case {
+	return &Case{Exp: exp, Whens: make([]*CaseWhen, 0, _defaultCapicity)}
+}
+
+// FrameUnit is unit of window frame, ROWS or RANGE
+type FrameUnit string
+
+// String
+func (u FrameUnit) String() string {
+	return string(u)
+}
+
+const (
+	FrameRows  FrameUnit = ansi.Rows
+	FrameRange FrameUnit = ansi.Range
+)
+
+// FrameBound is start or end of window frame
+type FrameBound string
+
+// String
+func (b FrameBound) String() string {
+	return string(b)
+}
+
+const (
+	UnboundedPreceding FrameBound = "UNBOUNDED PRECEDING"
+	UnboundedFollowing FrameBound = "UNBOUNDED FOLLOWING"
+	CurrentRow         FrameBound = "CURRENT ROW"
+)
+
+// Preceding return n PRECEDING
+func Preceding(n int) FrameBound {
+	return FrameBound(strconv.Itoa(n) + " PRECEDING")
+}
+
+// Following return n FOLLOWING
+func Following(n int) FrameBound {
+	return FrameBound(strconv.Itoa(n) + " FOLLOWING")
+}
+
+// Frame is frame of window, End is optional
+type Frame struct {
+	Unit  FrameUnit
+	Start FrameBound
+	End   FrameBound
+}
+
+// String
+func (f *Frame) String() string {
+	if f == nil {
+		return _nilStr
+	}
+	if f.End == "" {
+		return fmt.Sprint(f.Unit, " ", f.Start)
+	}
+	return fmt.Sprint(f.Unit, " ", ansi.Between, " ", f.Start, " ", ansi.And, " ", f.End)
+}
+
+// Window is window function, Func OVER (PARTITION BY ... ORDER BY ... frame)
+type Window struct {
+	// Func is *Call or *Aggregate
+	Func        Expression
+	PartitionBy []Expression
+	OrderBy     *OrderBy
+	Frame       *Frame
+}
+
+// String
+func (w *Window) String() string {
+	if w == nil {
+		return _nilStr
+	}
+	return fmt.Sprint(w.Func, " ", ansi.Over, " (", ansi.PartitionBy, " ", w.PartitionBy, " ", w.OrderBy, " ", w.Frame, ")")
+}
+
+// Node return NodeWindow
+func (w *Window) Node() NodeType {
+	return NodeWindow
+}
+
+// Partition append columns to PARTITION BY
+func (w *Window) Partition(columns ...string) *Window {
+	for i := 0; i < len(columns); i++ {
+		w.PartitionBy = append(w.PartitionBy, Column(columns[i]))
+	}
+	return w
+}
+
+// UseOrderBy initialize w.OrderBy then return it
+func (w *Window) UseOrderBy() *OrderBy {
+	if w.OrderBy == nil {
+		w.OrderBy = NewOrderBy()
+	}
+	return w.OrderBy
+}
+
+// Rows set frame ROWS BETWEEN start AND end, end is optional
+func (w *Window) Rows(start, end FrameBound) *Window {
+	w.Frame = &Frame{Unit: FrameRows, Start: start, End: end}
+	return w
+}
+
+// Range set frame RANGE BETWEEN start AND end, end is optional
+func (w *Window) Range(start, end FrameBound) *Window {
+	w.Frame = &Frame{Unit: FrameRange, Start: start, End: end}
+	return w
+}
+
+// NewWindow return *Window of function, fn is *Call or *Aggregate
+func NewWindow(fn Expression) *Window {
+	return &Window{Func: fn}
+}
+
 // Where is sql where clause
 type Where struct {
 	*Conditions
@@ -724,6 +1058,9 @@ func NewGroupBy() *GroupBy {
 type Table struct {
 	Name  string
 	Alias string
+
+	// Query is sub query of derived table, Name is ignored if Query isn't nil
+	Query *Query
 }
 
 // String
@@ -732,10 +1069,14 @@ func (t *Table) String() string {
 		return _nilStr
 	}
 
+	name := t.Name
+	if t.Query != nil {
+		name = fmt.Sprint("(", t.Query, ")")
+	}
 	if t.Alias == "" {
-		return t.Name
+		return name
 	}
-	return fmt.Sprint(t.Name, " AS ", t.Alias)
+	return fmt.Sprint(name, " AS ", t.Alias)
 }
 
 // Node return NodeTable
@@ -750,6 +1091,14 @@ func newTable(name string, alias string) *Table {
 	}
 }
 
+// NewDerivedTable return a *Table of sub query
+func NewDerivedTable(query *Query, alias string) *Table {
+	return &Table{
+		Query: query,
+		Alias: alias,
+	}
+}
+
 // Field is each field in sql select clause
 type Field struct {
 	Exp   Expression
@@ -991,12 +1340,29 @@ func NewFrom(table, alias string) *From {
 	}
 }
 
+// NewFromQuery return *From of sub query
+func NewFromQuery(query *Query, alias string) *From {
+	return &From{
+		Table: NewDerivedTable(query, alias),
+	}
+}
+
 // ThenFrom append a table to from 
 func (f *From) ThenFrom(table, alias string) *From {
+	return f.ThenFromTable(newTable(table, alias))
+}
+
+// ThenFromQuery append a sub query to from
+func (f *From) ThenFromQuery(query *Query, alias string) *From {
+	return f.ThenFromTable(NewDerivedTable(query, alias))
+}
+
+// ThenFromTable append a *Table to from
+func (f *From) ThenFromTable(t *Table) *From {
 	if f.Tables == nil {
 		f.Tables = make([]*Table, 0, _defaultCapicity)
 	}
-	f.Tables = append(f.Tables, newTable(table, alias))
+	f.Tables = append(f.Tables, t)
 	return f
 }
 
@@ -1044,6 +1410,13 @@ func (f *From) Join(join *Join) *From {
 	return f
 }
 
+// JoinQuery append join of sub query to *From
+func (f *From) JoinQuery(joinType JoinType, query *Query, alias string) *Join {
+	j := NewJoinTable(joinType, f.Table, NewDerivedTable(query, alias))
+	f.Join(j)
+	return j
+}
+
 // Join append cross join to *From
 func (f *From) CrossJoin(toTable, toTableAlias string) *Join {
 	return f.addJoin(CrossJoin, toTable, toTableAlias)
@@ -1131,3 +1504,102 @@ func NewJoinTable(joinType JoinType, left, right *Table) *Join {
 		Conditions: newConditions(),
 	}
 }
+
+// Output is returned columns of insert, update and delete,
+// compiled to RETURNING, OUTPUT INSERTED/DELETED or RETURNING INTO according to dialect, mysql is not supported
+type Output struct {
+	Columns []Column
+}
+
+// String
+func (o *Output) String() string {
+	if o == nil {
+		return _nilStr
+	}
+	return fmt.Sprint(ansi.Output, " ", o.Columns)
+}
+
+// Node return NodeOutput
+func (o *Output) Node() NodeType {
+	return NodeOutput
+}
+
+// Column append columns to output list
+func (o *Output) Column(columns ...string) *Output {
+	for i := 0; i < len(columns); i++ {
+		o.Columns = append(o.Columns, Column(columns[i]))
+	}
+	return o
+}
+
+func (o *Output) isEmpty() bool {
+	return o == nil || len(o.Columns) == 0
+}
+
+// NewOutput return *Output with provided columns
+func NewOutput(columns ...string) *Output {
+	o := &Output{Columns: make([]Column, 0, len(columns))}
+	return o.Column(columns...)
+}
+
+// CommonTable is a named query of with clause
+type CommonTable struct {
+	// Name is name of common table
+	Name string
+
+	// Columns is optional column names of common table
+	Columns []string
+
+	// Query is *Query or *Compound, recursive common table is a *Compound references itself
+	Query Expression
+}
+
+// String
+func (ct *CommonTable) String() string {
+	if ct == nil {
+		return _nilStr
+	}
+	return fmt.Sprint(ct.Name, " ", ct.Columns, " ", ansi.As, " (", ct.Query, ")")
+}
+
+// With is with clause, a list of common table expressions
+type With struct {
+	// Recursive means WITH RECURSIVE, keyword RECURSIVE is omitted on sql server and oracle
+	Recursive bool
+
+	Tables []*CommonTable
+}
+
+// String
+func (w *With) String() string {
+	if w == nil {
+		return _nilStr
+	}
+	return fmt.Sprint(ansi.With, " ", w.Recursive, " ", w.Tables)
+}
+
+// Node return NodeWith
+func (w *With) Node() NodeType {
+	return NodeWith
+}
+
+// Table append a common table, query should be *Query or *Compound
+func (w *With) Table(name string, query Expression, columns ...string) *With {
+	w.Tables = append(w.Tables, &CommonTable{Name: name, Columns: columns, Query: query})
+	return w
+}
+
+// RecursiveTable append a recursive common table and set Recursive = true
+func (w *With) RecursiveTable(name string, query Expression, columns ...string) *With {
+	w.Recursive = true
+	return w.Table(name, query, columns...)
+}
+
+func (w *With) isEmpty() bool {
+	return w == nil || len(w.Tables) == 0
+}
+
+// NewWith return *With
+func NewWith() *With {
+	return &With{Tables: make([]*CommonTable, 0, _defaultCapicity)}
+}
@@ -1,6 +1,7 @@
 package kdb
 
 import (
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -518,3 +519,790 @@ VALUES( ? ,  ? ,  ? ,  ? ,  ? ,  ? ,  ? ,  ? );
 		t.Error("compiled insert sql error")
 	}
 }
+
+func TestQueryLimit(t *testing.T) {
+	page := func() *Query {
+		q := NewQuery("ttable", "")
+		q.Where.Equals("cint", 42)
+		q.UseOrderBy().Asc("cint")
+		return q.Limit(20, 10)
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{MysqlDialecter{}, `SELECT * FROM ttable WHERE cint = ? ORDER BY cint ASC LIMIT 20,10;`},
+		{PostgreSQLDialecter{}, `SELECT * FROM ttable WHERE cint = $1 ORDER BY cint ASC LIMIT 10 OFFSET 20;`},
+		{SqliteDialecter{}, `SELECT * FROM ttable WHERE cint = ? ORDER BY cint ASC LIMIT 10 OFFSET 20;`},
+		{MssqlDialecter{}, `SELECT * FROM ttable WHERE cint = ? ORDER BY cint ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY;`},
+		{OracleSQLDialecter{}, `SELECT * FROM ttable WHERE cint = :pv1 ORDER BY cint ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", page())
+		if err != nil {
+			t.Error("compile query error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled limit sql error", c.dialecter.Name(), "\n", query, "\n", c.want)
+		}
+	}
+
+	q := NewQuery("ttable", "").Limit(0, 10)
+	query, _, _ := NewSqlDriver(MssqlDialecter{}).Compile("source", q)
+	if want := `SELECT * FROM ttable ORDER BY (SELECT NULL) OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY;`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql limit sql error", "\n", query, "\n", want)
+	}
+
+	query, _, _ = NewSqlDriver(MssqlDialecter{Version: 10}).Compile("source", q)
+	if want := `SELECT TOP (10) * FROM ttable;`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql top sql error", "\n", query, "\n", want)
+	}
+
+	query, _, _ = NewSqlDriver(OracleSQLDialecter{}).Compile("source", q)
+	if want := `SELECT * FROM ttable FETCH FIRST 10 ROWS ONLY`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled oracle limit sql error", "\n", query, "\n", want)
+	}
+
+	mssql10 := NewSqlDriver(MssqlDialecter{Version: 10})
+	q = page()
+	q.Select.Column("t.cint").ColumnAs("cstring", "s")
+	query, _, err := mssql10.Compile("source", q)
+	want := `SELECT cint, [s] FROM (SELECT t.cint, cstring AS [s], ROW_NUMBER() OVER (ORDER BY cint ASC) AS kdb_rownum FROM ttable WHERE cint = ?)
+		AS kdb_t WHERE kdb_rownum > 20 AND kdb_rownum <= 30 ORDER BY kdb_rownum;`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql row number sql error", err, "\n", query, "\n", want)
+	}
+
+	q = page().Distinct()
+	q.Select.Column("cint").ColumnAs("cstring", "s")
+	q.OrderBy.Desc("cstring")
+	query, _, err = mssql10.Compile("source", q)
+	want = `SELECT cint, [s] FROM (SELECT kdb_t.*, ROW_NUMBER() OVER (ORDER BY cint ASC, [s] DESC) AS kdb_rownum FROM (
+		SELECT DISTINCT cint, cstring AS [s] FROM ttable WHERE cint = ?) AS kdb_t)
+		AS kdb_t WHERE kdb_rownum > 20 AND kdb_rownum <= 30 ORDER BY kdb_rownum;`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql distinct row number sql error", err, "\n", query, "\n", want)
+	}
+
+	if _, _, err = mssql10.Compile("source", page()); err == nil {
+		t.Error("mssql row number paging of select * should return error")
+	}
+
+	oracle11 := NewSqlDriver(OracleSQLDialecter{Version: 11})
+	q = page()
+	q.Select.Column("t.cint").ColumnAs("cstring", "s")
+	query, _, err = oracle11.Compile("source", q)
+	want = `SELECT cint, "s" FROM (SELECT kdb_t.*, ROWNUM kdb_rownum FROM (SELECT t.cint, cstring AS "s" FROM ttable WHERE cint = :pv1 ORDER BY cint ASC) kdb_t
+		WHERE ROWNUM <= 30) WHERE kdb_rownum > 20`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled oracle rownum sql error", err, "\n", query, "\n", want)
+	}
+	if _, _, err = oracle11.Compile("source", page()); err == nil {
+		t.Error("oracle rownum paging of select * should return error")
+	}
+	q = NewQuery("ttable", "").Distinct().Limit(20, 10)
+	q.Select.Column("cint")
+	if _, _, err = NewSqlDriver(MssqlDialecter{}).Compile("source", q); err == nil {
+		t.Error("mssql paging distinct query without order by should return error")
+	}
+	q.UseOrderBy().Asc("cfloat")
+	if _, _, err = mssql10.Compile("source", q); err == nil {
+		t.Error("mssql paging distinct query order by column isn't selected should return error")
+	}
+}
+
+func TestUpdateDeleteLimit(t *testing.T) {
+	u := NewUpdate("ttable").Set("cint", 1).Limit(10)
+	d := NewDelete("ttable").Limit(10)
+	d.Where.Equals("cint", 1)
+
+	cases := []struct {
+		dialecter Dialecter
+		exp       Expression
+		want      string
+	}{
+		{MysqlDialecter{}, u, `UPDATE ttable SET cint=? LIMIT 10;`},
+		{MssqlDialecter{}, u, `UPDATE TOP (10) ttable SET cint=?;`},
+		{MssqlDialecter{}, d, `DELETE TOP (10) FROM ttable WHERE cint = ?;`},
+		{OracleSQLDialecter{}, d, `DELETE FROM ttable WHERE (cint = :pv1) AND ROWNUM <= 10`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", c.exp)
+		if err != nil {
+			t.Error("compile limit error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled limit sql error", c.dialecter.Name(), "\n", query, "\n", c.want)
+		}
+	}
+
+	if _, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", d); err == nil {
+		t.Error("postgres should not support limit in delete")
+	}
+
+	u.OrderBy.Asc("cint")
+	if _, _, err := NewSqlDriver(MssqlDialecter{}).Compile("source", u); err == nil {
+		t.Error("mssql should not support order by with limit in update")
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	q := NewQuery("public.Order", "o")
+	q.Select.Column("o.order", "o.*").Count("id", "cnt")
+	q.Where.Equals("o.Group", 1)
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `SELECT "o"."order", "o".*, COUNT("id") AS "cnt" FROM "public"."Order" AS "o" WHERE "o"."Group" = $1;`},
+		{MysqlDialecter{}, "SELECT `o`.`order`, `o`.*, COUNT(`id`) AS `cnt` FROM `public`.`Order` AS `o` WHERE `o`.`Group` = ?;"},
+		{MssqlDialecter{}, `SELECT [o].[order], [o].*, COUNT([id]) AS [cnt] FROM [public].[Order] AS [o] WHERE [o].[Group] = ?;`},
+		{OracleSQLDialecter{}, `SELECT "o"."order", "o".*, COUNT("id") AS "cnt" FROM "public"."Order" "o" WHERE "o"."Group" = :pv1`},
+	}
+
+	for _, c := range cases {
+		driver := NewSqlDriver(c.dialecter).(OptionCompiler)
+		query, _, err := driver.CompileWithOptions("source", q, CompileOptions{QuoteIdentifier: true})
+		if err != nil {
+			t.Error("compile query error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled quote sql error", c.dialecter.Name(), "\n", query, "\n", c.want)
+		}
+	}
+
+	u := NewUpdate("order").Set("desc", 1)
+	u.Where.Equals("id", 2)
+	driver := NewSqlDriver(PostgreSQLDialecter{}).(OptionCompiler)
+	query, _, _ := driver.CompileWithOptions("source", u, CompileOptions{QuoteIdentifier: true})
+	if want := `UPDATE "order" SET "desc"=$1 WHERE "id" = $2;`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled quote update sql error", "\n", query, "\n", want)
+	}
+
+	if s := (MssqlDialecter{}).Quote("a]b"); s != "[a]]b]" {
+		t.Error("mssql quote error", s)
+	}
+	if s := (OracleSQLDialecter{}).Quote(`a"b`); s != `"a""b"` {
+		t.Error("oracle quote error", s)
+	}
+}
+
+func TestReturning(t *testing.T) {
+	insert := NewInsert("ttable").Set("cstring", "a").Returning("id", "cint")
+	update := NewUpdate("ttable").Set("cstring", "a").Returning("id")
+	update.Where.Equals("cint", 42)
+	del := NewDelete("ttable").Returning("*")
+	del.Where.Equals("cint", 42)
+
+	cases := []struct {
+		dialecter Dialecter
+		exp       Expression
+		want      string
+	}{
+		{PostgreSQLDialecter{}, insert, `INSERT INTO ttable(cstring) VALUES($1) RETURNING id, cint;`},
+		{PostgreSQLDialecter{}, update, `UPDATE ttable SET cstring=$1 WHERE cint = $2 RETURNING id;`},
+		{SqliteDialecter{}, del, `DELETE FROM ttable WHERE cint = ? RETURNING *;`},
+		{MssqlDialecter{}, insert, `INSERT INTO ttable(cstring) OUTPUT INSERTED.id, INSERTED.cint VALUES(?);`},
+		{MssqlDialecter{}, update, `UPDATE ttable SET cstring=? OUTPUT INSERTED.id WHERE cint = ?;`},
+		{MssqlDialecter{}, del, `DELETE FROM ttable OUTPUT DELETED.* WHERE cint = ?;`},
+		{OracleSQLDialecter{}, update, `UPDATE ttable SET cstring=:pv1 WHERE cint = :pv2 RETURNING id INTO :pv3`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", c.exp)
+		if err != nil {
+			t.Error("compile returning error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled returning sql error", c.dialecter.Name(), "\n", query, "\n", c.want)
+		}
+	}
+
+	if _, _, err := NewSqlDriver(MysqlDialecter{}).Compile("source", insert); err == nil {
+		t.Error("mysql should not support returning")
+	}
+	if _, _, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", del); err == nil {
+		t.Error("oracle should not support returning *")
+	}
+}
+
+func TestInsertRows(t *testing.T) {
+	insert := NewInsert("ttable").Set("cint", 1).Set("cstring", "a")
+	insert.Row(2, "b").Row(3, nil)
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `INSERT INTO ttable(cint, cstring) VALUES($1, $2), ($3, $4), ($5, NULL);`},
+		{OracleSQLDialecter{}, `INSERT ALL INTO ttable(cint, cstring) VALUES(:pv1, :pv2) INTO ttable(cint, cstring) VALUES(:pv3, :pv4) INTO ttable(cint, cstring) VALUES(:pv5, NULL) SELECT 1 FROM DUAL`},
+	}
+
+	for _, c := range cases {
+		query, args, err := NewSqlDriver(c.dialecter).Compile("source", insert)
+		if err != nil {
+			t.Error("compile insert rows error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) || len(args) != 5 {
+			t.Error("compiled insert rows sql error", c.dialecter.Name(), "\n", query, "\n", c.want, args)
+		}
+	}
+
+	insert.Row(4)
+	if _, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", insert); err == nil {
+		t.Error("compile insert should return error when count of values doesn't match columns")
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	u := NewUpsert("ttable", "id").Set("id", 1).Set("cstring", "a")
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `INSERT INTO ttable(id, cstring) VALUES($1, $2) ON CONFLICT (id) DO UPDATE SET cstring=EXCLUDED.cstring;`},
+		{SqliteDialecter{}, `INSERT INTO ttable(id, cstring) VALUES(?, ?) ON CONFLICT (id) DO UPDATE SET cstring=EXCLUDED.cstring;`},
+		{MysqlDialecter{}, `INSERT INTO ttable(id, cstring) VALUES(?, ?) ON DUPLICATE KEY UPDATE cstring=VALUES(cstring);`},
+		{MssqlDialecter{}, `MERGE INTO ttable AS kdb_target USING (SELECT ? AS id, ? AS cstring) AS kdb_source ON (kdb_target.id=kdb_source.id) 
+			WHEN MATCHED THEN UPDATE SET kdb_target.cstring=kdb_source.cstring 
+			WHEN NOT MATCHED THEN INSERT (id, cstring) VALUES (kdb_source.id, kdb_source.cstring);`},
+		{OracleSQLDialecter{}, `MERGE INTO ttable kdb_target USING (SELECT :pv1 AS id, :pv2 AS cstring FROM DUAL) kdb_source ON (kdb_target.id=kdb_source.id) 
+			WHEN MATCHED THEN UPDATE SET kdb_target.cstring=kdb_source.cstring 
+			WHEN NOT MATCHED THEN INSERT (id, cstring) VALUES (kdb_source.id, kdb_source.cstring)`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", u)
+		if err != nil {
+			t.Error("compile upsert error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled upsert sql error", c.dialecter.Name(), "\n", query, "\n", c.want)
+		}
+	}
+
+	query, _, _ := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", NewUpsert("ttable", "id").Set("id", 1))
+	if want := `INSERT INTO ttable(id) VALUES($1) ON CONFLICT (id) DO NOTHING;`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled upsert do nothing sql error", "\n", query, "\n", want)
+	}
+
+	if _, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", NewUpsert("ttable", "cint").Set("id", 1)); err == nil {
+		t.Error("compile upsert should return error when key isn't in sets")
+	}
+}
+
+func TestSubQuery(t *testing.T) {
+	sub := NewQuery("ttable_c", "")
+	sub.Select.Column("c_int")
+	sub.Where.GreaterThan("c_int", 10)
+
+	q := NewQuery("ttable", "t1")
+	q.Where.Equals("cstring", "a").In("cint", sub)
+
+	exists := NewQuery("ttable_c", "c")
+	exists.Where.Equals("c.c_string", "b").Sql("c.c_int = t1.cint")
+	q.Where.Exists(exists)
+
+	scalar := NewQuery("ttable_c", "")
+	scalar.Select.Count("*", "")
+	q.Select.Column("cint").Exp(scalar, "cnt")
+
+	query, args, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q)
+	if err != nil {
+		t.Fatal("compile sub query error", err)
+	}
+	want := `SELECT cint, (SELECT COUNT(*) FROM ttable_c) AS "cnt" FROM ttable AS t1 
+		WHERE cstring = $1 AND cint IN (SELECT c_int FROM ttable_c WHERE c_int > $2) 
+		AND EXISTS (SELECT * FROM ttable_c AS c WHERE c.c_string = $3 AND c.c_int = t1.cint);`
+	if removeSpace(query) != removeSpace(want) || len(args) != 3 {
+		t.Error("compiled sub query sql error", "\n", query, "\n", want, args)
+	}
+
+	derived := NewQuery("ttable", "")
+	derived.Where.Equals("cint", 1)
+	derived.Limit(0, 10)
+	outer := NewQueryFrom(derived, "d")
+	outer.From.JoinQuery(InnerJoin, sub, "s").On("d.cint", "s.c_int")
+	outer.Where.Equals("d.cstring", "a")
+
+	query, _, err = NewSqlDriver(OracleSQLDialecter{}).Compile("source", outer)
+	if err != nil {
+		t.Fatal("compile derived table error", err)
+	}
+	want = `SELECT * FROM (SELECT * FROM ttable WHERE cint = :pv1 FETCH FIRST 10 ROWS ONLY) d 
+		INNER JOIN (SELECT c_int FROM ttable_c WHERE c_int > :pv2) s ON d.cint = s.c_int 
+		WHERE d.cstring = :pv3`
+	if removeSpace(query) != removeSpace(want) {
+		t.Error("compiled derived table sql error", "\n", query, "\n", want)
+	}
+}
+
+func TestCompound(t *testing.T) {
+	compound := func() *Compound {
+		q1 := NewQuery("ttable", "")
+		q1.Select.Column("cint")
+		q1.Where.Equals("cstring", "a")
+
+		q2 := NewQuery("ttable_c", "")
+		q2.Select.Column("c_int")
+		q2.Where.Equals("c_string", "b")
+
+		c := NewCompound(q1).UnionAll(q2).Except(NewQuery("ttable_d", ""))
+		c.UseOrderBy().Desc("cint")
+		return c.Limit(20, 10)
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{MysqlDialecter{}, `SELECT cint FROM ttable WHERE cstring = ? UNION ALL SELECT c_int FROM ttable_c WHERE c_string = ? 
+			EXCEPT SELECT * FROM ttable_d ORDER BY cint DESC LIMIT 20,10;`},
+		{PostgreSQLDialecter{}, `SELECT cint FROM ttable WHERE cstring = $1 UNION ALL SELECT c_int FROM ttable_c WHERE c_string = $2 
+			EXCEPT SELECT * FROM ttable_d ORDER BY cint DESC LIMIT 10 OFFSET 20;`},
+		{MssqlDialecter{}, `SELECT cint FROM ttable WHERE cstring = ? UNION ALL SELECT c_int FROM ttable_c WHERE c_string = ? 
+			EXCEPT SELECT * FROM ttable_d ORDER BY cint DESC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY;`},
+		{MssqlDialecter{Version: 10}, `SELECT cint FROM (SELECT kdb_t.*, ROW_NUMBER() OVER (ORDER BY cint DESC) AS kdb_rownum FROM (
+			SELECT cint FROM ttable WHERE cstring = ? UNION ALL SELECT c_int FROM ttable_c WHERE c_string = ? 
+			EXCEPT SELECT * FROM ttable_d) AS kdb_t) AS kdb_t WHERE kdb_rownum > 20 AND kdb_rownum <= 30 ORDER BY kdb_rownum;`},
+		{OracleSQLDialecter{}, `SELECT cint FROM ttable WHERE cstring = :pv1 UNION ALL SELECT c_int FROM ttable_c WHERE c_string = :pv2 
+			MINUS SELECT * FROM ttable_d ORDER BY cint DESC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		{OracleSQLDialecter{Version: 11}, `SELECT cint FROM (SELECT kdb_t.*, ROWNUM kdb_rownum FROM (
+			SELECT cint FROM ttable WHERE cstring = :pv1 UNION ALL SELECT c_int FROM ttable_c WHERE c_string = :pv2 
+			MINUS SELECT * FROM ttable_d ORDER BY cint DESC) kdb_t WHERE ROWNUM <= 30) WHERE kdb_rownum > 20`},
+	}
+
+	for _, c := range cases {
+		query, args, err := NewSqlDriver(c.dialecter).Compile("source", compound())
+		if err != nil {
+			t.Error("compile compound error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) || len(args) != 2 {
+			t.Error("compiled compound sql error", c.dialecter.Name(), "\n", query, "\n", c.want, args)
+		}
+	}
+
+	if _, _, err := NewSqlDriver(MysqlDialecter{Version: 5}).Compile("source", compound()); err == nil {
+		t.Error("mysql 5 should not support except")
+	}
+
+	top := NewQuery("ttable", "").Limit(0, 5)
+	top.UseOrderBy().Asc("cint")
+	c := NewCompound(top).Union(NewQuery("ttable_c", ""))
+	query, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", c)
+	if want := `(SELECT * FROM ttable ORDER BY cint ASC LIMIT 5) UNION SELECT * FROM ttable_c;`; err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled compound sql error", err, "\n", query, "\n", want)
+	}
+	if _, _, err := NewSqlDriver(SqliteDialecter{}).Compile("source", c); err == nil {
+		t.Error("sqlite should not support limit in query of compound")
+	}
+
+	in := NewQuery("ttable", "")
+	in.Where.Equals("cstring", "a").In("cint", compound())
+	query, args, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", in)
+	want := `SELECT * FROM ttable WHERE cstring = $1 AND cint IN (SELECT cint FROM ttable WHERE cstring = $2 UNION ALL 
+		SELECT c_int FROM ttable_c WHERE c_string = $3 EXCEPT SELECT * FROM ttable_d ORDER BY cint DESC LIMIT 10 OFFSET 20);`
+	if err != nil || removeSpace(query) != removeSpace(want) || len(args) != 3 {
+		t.Error("compiled compound sub query error", err, "\n", query, "\n", want, args)
+	}
+}
+
+func TestWith(t *testing.T) {
+	tree := func() *Query {
+		anchor := NewQuery("org", "")
+		anchor.Select.Column("id").Column("parent_id")
+		anchor.Where.Equals("id", 1)
+
+		children := NewQuery("org", "o")
+		children.Select.Column("o.id").Column("o.parent_id")
+		children.From.InnerJoin("tree", "t").On("o.parent_id", "t.id")
+
+		q := NewQuery("tree", "")
+		q.UseWith().RecursiveTable("tree", NewCompound(anchor).UnionAll(children), "id", "parent_id")
+		q.Where.NotEquals("id", 2)
+		return q
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `WITH RECURSIVE tree (id, parent_id) AS (SELECT id, parent_id FROM org WHERE id = $1 
+			UNION ALL SELECT o.id, o.parent_id FROM org AS o INNER JOIN tree AS t ON o.parent_id = t.id) 
+			SELECT * FROM tree WHERE id <> $2;`},
+		{MssqlDialecter{}, `WITH tree (id, parent_id) AS (SELECT id, parent_id FROM org WHERE id = ? 
+			UNION ALL SELECT o.id, o.parent_id FROM org AS o INNER JOIN tree AS t ON o.parent_id = t.id) 
+			SELECT * FROM tree WHERE id <> ?;`},
+		{OracleSQLDialecter{}, `WITH tree (id, parent_id) AS (SELECT id, parent_id FROM org WHERE id = :pv1 
+			UNION ALL SELECT o.id, o.parent_id FROM org o INNER JOIN tree t ON o.parent_id = t.id) 
+			SELECT * FROM tree WHERE id <> :pv2`},
+	}
+
+	for _, c := range cases {
+		query, args, err := NewSqlDriver(c.dialecter).Compile("source", tree())
+		if err != nil {
+			t.Error("compile with error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) || len(args) != 2 || args[0] != 1 {
+			t.Error("compiled with sql error", c.dialecter.Name(), "\n", query, "\n", c.want, args)
+		}
+	}
+
+	if _, _, err := NewSqlDriver(MysqlDialecter{Version: 5}).Compile("source", tree()); err == nil {
+		t.Error("mysql 5 should not support with clause")
+	}
+
+	expired := NewQuery("ttable_c", "")
+	expired.Select.Column("c_int")
+	expired.Where.LessThan("c_int", 10)
+
+	del := NewDelete("ttable")
+	del.UseWith().Table("expired", expired)
+	del.Where.In("cint", NewQuery("expired", ""))
+
+	query, _, err := NewSqlDriver(MysqlDialecter{}).Compile("source", del)
+	want := `WITH expired AS (SELECT c_int FROM ttable_c WHERE c_int < ?) DELETE FROM ttable WHERE cint IN (SELECT * FROM expired);`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled delete with sql error", err, "\n", query, "\n", want)
+	}
+
+	if _, _, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", del); err == nil {
+		t.Error("oracle should not support with clause on delete")
+	}
+}
+
+func TestCallAndCase(t *testing.T) {
+	build := func() *Query {
+		level := NewCase().When(GreaterThan, "cint", 100, "high").When(GreaterThan, "cint", 10, "middle").OrElse("low")
+
+		q := NewQuery("ttable", "")
+		q.Select.Column("cint").
+			Exp(NewCall(Concat, Column("cstring"), "-", Column("cint")), "name").
+			Exp(NewCall(Substring, NewCall(Upper, Column("cstring")), 1, 3), "prefix").
+			Exp(level, "level")
+		q.Where.Condition(Equals, NewCall(Lower, Column("cstring")), &Value{Value: "a"}).
+			Condition(LessThan, Column("cdatetime"), NewCall(CurrentTime))
+		q.UseOrderBy().By(Asc, NewSimpleCase(Column("cint")).WhenValue(1, 0).OrElse(1))
+		return q
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{MysqlDialecter{}, `SELECT cint, CONCAT(cstring, ?, cint) AS ` + "`name`" + `, SUBSTRING(UPPER(cstring), ?, ?) AS ` + "`prefix`" + `, 
+			CASE WHEN cint > ? THEN ? WHEN cint > ? THEN ? ELSE ? END AS ` + "`level`" + ` FROM ttable 
+			WHERE LOWER(cstring) = ? AND cdatetime < NOW() ORDER BY CASE cint WHEN ? THEN ? ELSE ? END ASC;`},
+		{PostgreSQLDialecter{}, `SELECT cint, (cstring || $1 || cint) AS "name", SUBSTRING(UPPER(cstring), $2, $3) AS "prefix", 
+			CASE WHEN cint > $4 THEN $5 WHEN cint > $6 THEN $7 ELSE $8 END AS "level" FROM ttable 
+			WHERE LOWER(cstring) = $9 AND cdatetime < NOW() ORDER BY CASE cint WHEN $10 THEN $11 ELSE $12 END ASC;`},
+		{MssqlDialecter{Version: 10}, `SELECT cint, (cstring + ? + cint) AS [name], SUBSTRING(UPPER(cstring), ?, ?) AS [prefix], 
+			CASE WHEN cint > ? THEN ? WHEN cint > ? THEN ? ELSE ? END AS [level] FROM ttable 
+			WHERE LOWER(cstring) = ? AND cdatetime < GETDATE() ORDER BY CASE cint WHEN ? THEN ? ELSE ? END ASC;`},
+		{OracleSQLDialecter{}, `SELECT cint, (cstring || :pv1 || cint) AS "name", SUBSTR(UPPER(cstring), :pv2, :pv3) AS "prefix", 
+			CASE WHEN cint > :pv4 THEN :pv5 WHEN cint > :pv6 THEN :pv7 ELSE :pv8 END AS "level" FROM ttable 
+			WHERE LOWER(cstring) = :pv9 AND cdatetime < SYSDATE ORDER BY CASE cint WHEN :pv10 THEN :pv11 ELSE :pv12 END ASC`},
+	}
+
+	for _, c := range cases {
+		query, args, err := NewSqlDriver(c.dialecter).Compile("source", build())
+		if err != nil {
+			t.Error("compile call and case error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) || len(args) != 12 {
+			t.Error("compiled call and case sql error", c.dialecter.Name(), "\n", query, "\n", c.want, args)
+		}
+	}
+
+	u := NewUpdate("ttable").Set("cdatetime", NewCall(CurrentTime)).Set("cstring", NewCall(Coalesce, Column("cstring"), ""))
+	u.Where.Equals("cint", 1)
+	query, _, err := NewSqlDriver(SqliteDialecter{}).Compile("source", u)
+	if want := `UPDATE ttable SET cdatetime=CURRENT_TIMESTAMP, cstring=COALESCE(cstring, ?) WHERE cint = ?;`; err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled update call sql error", err, "\n", query, "\n", want)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	build := func() *Query {
+		rowNumber := NewWindow(NewCall(RowNumber)).Partition("cstring")
+		rowNumber.UseOrderBy().Desc("cint")
+
+		running := NewWindow(NewAggregate(Sum, Column("cint"))).Partition("cstring").Rows(UnboundedPreceding, CurrentRow)
+		running.UseOrderBy().Asc("cdatetime")
+
+		previous := NewWindow(NewCall(Lag, Column("cint"), 1))
+		previous.UseOrderBy().Asc("cdatetime")
+
+		q := NewQuery("ttable", "")
+		q.Select.Column("cint").Exp(rowNumber, "rn").Exp(running, "total").Exp(previous, "prev")
+		return q
+	}
+
+	query, args, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", build())
+	want := `SELECT cint, ROW_NUMBER() OVER (PARTITION BY cstring ORDER BY cint DESC) AS "rn", 
+		SUM(cint) OVER (PARTITION BY cstring ORDER BY cdatetime ASC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS "total", 
+		LAG(cint, $1) OVER (ORDER BY cdatetime ASC) AS "prev" FROM ttable;`
+	if err != nil || removeSpace(query) != removeSpace(want) || len(args) != 1 {
+		t.Error("compiled window sql error", err, "\n", query, "\n", want, args)
+	}
+
+	if _, _, err := NewSqlDriver(MysqlDialecter{}).Compile("source", build()); err != nil {
+		t.Error("mysql 8 should support window function", err)
+	}
+	if _, _, err := NewSqlDriver(MysqlDialecter{Version: 5}).Compile("source", build()); err == nil {
+		t.Error("mysql 5 should not support window function")
+	}
+	if _, _, err := NewSqlDriver(MssqlDialecter{Version: 10}).Compile("source", build()); err == nil {
+		t.Error("sql server 2008 should not support frame in window")
+	}
+
+	lag := NewQuery("ttable", "")
+	previous := NewWindow(NewCall(Lag, Column("cint"), 1))
+	previous.UseOrderBy().Asc("cdatetime")
+	lag.Select.Exp(previous, "prev")
+	if _, _, err := NewSqlDriver(MssqlDialecter{Version: 10}).Compile("source", lag); err == nil {
+		t.Error("sql server 2008 should not support LAG")
+	}
+	if _, _, err := NewSqlDriver(MssqlDialecter{Version: 11}).Compile("source", lag); err != nil {
+		t.Error("sql server 2012 should support LAG", err)
+	}
+
+	q := NewQuery("ttable", "")
+	q.Select.Exp(NewWindow(NewCall(Rank)).Range(Preceding(2), ""), "r")
+	if _, _, err = NewSqlDriver(OracleSQLDialecter{}).Compile("source", q); err == nil {
+		t.Error("ranking function should not support frame")
+	}
+
+	q = NewQuery("ttable", "")
+	q.Select.Exp(NewWindow(NewAggregate(Sum, Column("cint"))).Range(Preceding(2), ""), "r")
+	if _, _, err = NewSqlDriver(OracleSQLDialecter{}).Compile("source", q); err == nil {
+		t.Error("range frame with offset should require order by")
+	}
+
+	total := NewWindow(NewAggregate(Sum, Column("cint"))).Range(Preceding(2), "")
+	total.UseOrderBy().Asc("cint")
+	q = NewQuery("ttable", "")
+	q.Select.Exp(total, "r")
+	query, _, err = NewSqlDriver(OracleSQLDialecter{}).Compile("source", q)
+	if want := `SELECT SUM(cint) OVER (ORDER BY cint ASC RANGE 2 PRECEDING) AS "r" FROM ttable`; err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled window frame sql error", err, "\n", query, "\n", want)
+	}
+}
+
+func TestBetweenDistinctLike(t *testing.T) {
+	build := func() *Query {
+		q := NewQuery("ttable", "")
+		q.Where.Between("cint", 1, 10).NotBetween("cfloat", 0.5, 1.5).NullSafeEquals("cstring", nil)
+		return q
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `SELECT * FROM ttable WHERE cint BETWEEN $1 AND $2 AND cfloat NOT BETWEEN $3 AND $4 
+			AND cstring IS NOT DISTINCT FROM NULL;`},
+		{MysqlDialecter{}, `SELECT * FROM ttable WHERE cint BETWEEN ? AND ? AND cfloat NOT BETWEEN ? AND ? AND (cstring <=> NULL);`},
+		{SqliteDialecter{}, `SELECT * FROM ttable WHERE cint BETWEEN ? AND ? AND cfloat NOT BETWEEN ? AND ? AND cstring IS NULL;`},
+		{MssqlDialecter{}, `SELECT * FROM ttable WHERE cint BETWEEN ? AND ? AND cfloat NOT BETWEEN ? AND ? 
+			AND (cstring = NULL OR (cstring IS NULL AND NULL IS NULL));`},
+	}
+
+	for _, c := range cases {
+		query, args, err := NewSqlDriver(c.dialecter).Compile("source", build())
+		if err != nil {
+			t.Error("compile between error", c.dialecter.Name(), err)
+			continue
+		}
+		if removeSpace(query) != removeSpace(c.want) || len(args) != 4 {
+			t.Error("compiled between sql error", c.dialecter.Name(), "\n", query, "\n", c.want, args)
+		}
+	}
+
+	q := NewQuery("ttable", "")
+	q.Where.NullSafeNotEquals("cint", 1)
+	query, args, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", q)
+	want := `SELECT * FROM ttable WHERE (cint <> :pv1 OR (cint IS NULL AND :pv2 IS NOT NULL) OR (cint IS NOT NULL AND :pv3 IS NULL))`
+	if err != nil || removeSpace(query) != removeSpace(want) || len(args) != 3 {
+		t.Error("compiled null-safe not equals sql error", err, "\n", query, "\n", want, args)
+	}
+
+	q = NewQuery("ttable", "")
+	q.Where.StartsWith("cstring", `50%_off\`).Contains("cstring", "a_b").LikeEscape("cstring", "x!%%", "!")
+	query, args, err = NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q)
+	want = `SELECT * FROM ttable WHERE cstring LIKE $1 ESCAPE $2 AND cstring LIKE $3 ESCAPE $4 AND cstring LIKE $5 ESCAPE $6;`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled like escape sql error", err, "\n", query, "\n", want)
+	}
+	wantArgs := []interface{}{`50\%\_off\\%`, `\`, `%a\_b%`, `\`, "x!%%", "!"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("like escape args error; want=[%v]; actual=[%v]", wantArgs, args)
+	}
+
+	q = NewQuery("ttable", "")
+	q.Where.LikeEscape("cstring", "a", "!!")
+	if _, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q); err == nil {
+		t.Error("escape of like should be a single character")
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+	q := NewQuery("ttable", "")
+	q.Select.Column("cint", "cstring")
+	q.Where.LessThan("cdatetime", "2014-01-01")
+
+	insert := NewInsert("ttable_archive").Select(q, "cint", "cstring")
+	query, args, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", insert)
+	want := `INSERT INTO ttable_archive (cint, cstring) SELECT cint, cstring FROM ttable WHERE cdatetime < $1;`
+	if err != nil || removeSpace(query) != removeSpace(want) || len(args) != 1 {
+		t.Error("compiled insert select sql error", err, "\n", query, "\n", want, args)
+	}
+
+	insert.Returning("cint")
+	query, _, err = NewSqlDriver(MssqlDialecter{}).Compile("source", insert)
+	want = `INSERT INTO ttable_archive (cint, cstring) OUTPUT INSERTED.cint SELECT cint, cstring FROM ttable WHERE cdatetime < ?;`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql insert select sql error", err, "\n", query, "\n", want)
+	}
+
+	insert.Set("cint", 1)
+	if _, _, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", insert); err == nil {
+		t.Error("insert from query should not have values")
+	}
+}
+
+func TestUpdateDeleteJoin(t *testing.T) {
+	update := func() *Update {
+		u := NewUpdate("ttable").As("a").Set("a.cstring", Column("b.c_string"))
+		u.UseFrom("ttable_c", "b")
+		u.Where.Sql("a.cint = b.c_int").Equals("b.c_bool", true)
+		return u
+	}
+
+	del := func() *Delete {
+		d := NewDelete("ttable").As("a")
+		d.UseFrom("ttable_c", "b")
+		d.Where.Sql("a.cint = b.c_int").Equals("b.c_bool", true)
+		return d
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		update    string
+		delete    string
+	}{
+		{MysqlDialecter{},
+			`UPDATE ttable AS a, ttable_c AS b SET a.cstring=b.c_string WHERE a.cint = b.c_int AND b.c_bool = ?;`,
+			`DELETE a FROM ttable AS a, ttable_c AS b WHERE a.cint = b.c_int AND b.c_bool = ?;`},
+		{PostgreSQLDialecter{},
+			`UPDATE ttable AS a SET cstring=b.c_string FROM ttable_c AS b WHERE a.cint = b.c_int AND b.c_bool = $1;`,
+			`DELETE FROM ttable AS a USING ttable_c AS b WHERE a.cint = b.c_int AND b.c_bool = $1;`},
+		{MssqlDialecter{},
+			`UPDATE a SET a.cstring=b.c_string FROM ttable AS a, ttable_c AS b WHERE a.cint = b.c_int AND b.c_bool = ?;`,
+			`DELETE a FROM ttable AS a, ttable_c AS b WHERE a.cint = b.c_int AND b.c_bool = ?;`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", update())
+		if err != nil || removeSpace(query) != removeSpace(c.update) {
+			t.Error("compiled update join sql error", c.dialecter.Name(), err, "\n", query, "\n", c.update)
+		}
+		query, _, err = NewSqlDriver(c.dialecter).Compile("source", del())
+		if err != nil || removeSpace(query) != removeSpace(c.delete) {
+			t.Error("compiled delete join sql error", c.dialecter.Name(), err, "\n", query, "\n", c.delete)
+		}
+	}
+
+	u := update()
+	u.From.InnerJoin("ttable_d", "d").On("b.c_int", "d.d_int")
+	query, _, err := NewSqlDriver(SqliteDialecter{}).Compile("source", u)
+	want := `UPDATE ttable AS a SET cstring=b.c_string FROM ttable_c AS b INNER JOIN ttable_d AS d ON b.c_int = d.d_int 
+		WHERE a.cint = b.c_int AND b.c_bool = ?;`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled sqlite update join sql error", err, "\n", query, "\n", want)
+	}
+
+	if _, _, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", update()); err == nil {
+		t.Error("oracle should not support update with other tables")
+	}
+	if _, _, err := NewSqlDriver(SqliteDialecter{}).Compile("source", del()); err == nil {
+		t.Error("sqlite should not support delete with other tables")
+	}
+	if _, _, err := NewSqlDriver(MysqlDialecter{}).Compile("source", del().Limit(10)); err == nil {
+		t.Error("mysql should not support limit in multiple-table delete")
+	}
+}
+
+func TestLock(t *testing.T) {
+	build := func() *Query {
+		q := NewQuery("jobs", "j")
+		q.From.InnerJoin("workers", "w").On("j.worker_id", "w.id")
+		q.Where.Equals("j.status", "ready")
+		return q.Limit(0, 10).ForUpdate(SkipLocked, "j")
+	}
+
+	cases := []struct {
+		dialecter Dialecter
+		want      string
+	}{
+		{PostgreSQLDialecter{}, `SELECT * FROM jobs AS j INNER JOIN workers AS w ON j.worker_id = w.id WHERE j.status = $1 
+			LIMIT 10 FOR UPDATE OF j SKIP LOCKED;`},
+		{MysqlDialecter{}, `SELECT * FROM jobs AS j INNER JOIN workers AS w ON j.worker_id = w.id WHERE j.status = ? 
+			LIMIT 0,10 FOR UPDATE OF j SKIP LOCKED;`},
+		{MssqlDialecter{}, `SELECT * FROM jobs AS j WITH (UPDLOCK, ROWLOCK, READPAST) INNER JOIN workers AS w ON j.worker_id = w.id 
+			WHERE j.status = ? ORDER BY (SELECT NULL) OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY;`},
+	}
+
+	for _, c := range cases {
+		query, _, err := NewSqlDriver(c.dialecter).Compile("source", build())
+		if err != nil || removeSpace(query) != removeSpace(c.want) {
+			t.Error("compiled lock sql error", c.dialecter.Name(), err, "\n", query, "\n", c.want)
+		}
+	}
+
+	q := NewQuery("jobs", "")
+	q.Where.In("id", NewQuery("jobs_done", ""))
+	q.ForShare(NoWait)
+	query, _, err := NewSqlDriver(MssqlDialecter{}).Compile("source", q)
+	want := `SELECT * FROM jobs WITH (REPEATABLEREAD, ROWLOCK, NOWAIT) WHERE id IN (SELECT * FROM jobs_done);`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mssql share lock sql error", err, "\n", query, "\n", want)
+	}
+
+	q = NewQuery("jobs", "").ForShare(Wait)
+	query, _, err = NewSqlDriver(MysqlDialecter{Version: 5}).Compile("source", q)
+	if want := `SELECT * FROM jobs LOCK IN SHARE MODE;`; err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled mysql 5 share lock sql error", err, "\n", query, "\n", want)
+	}
+
+	if _, _, err := NewSqlDriver(SqliteDialecter{}).Compile("source", build()); err == nil {
+		t.Error("sqlite should not support row lock")
+	}
+	if _, _, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", build()); err == nil {
+		t.Error("oracle should not support row lock with limit")
+	}
+	if _, _, err := NewSqlDriver(OracleSQLDialecter{}).Compile("source", NewQuery("jobs", "j").ForUpdate(Wait, "j")); err == nil {
+		t.Error("oracle should not support lock of tables")
+	}
+	query, _, err = NewSqlDriver(OracleSQLDialecter{}).Compile("source", NewQuery("jobs", "j").ForUpdate(NoWait))
+	if want := `SELECT * FROM jobs j FOR UPDATE NOWAIT`; err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled oracle lock sql error", err, "\n", query, "\n", want)
+	}
+	if _, _, err := NewSqlDriver(MysqlDialecter{Version: 5}).Compile("source", build()); err == nil {
+		t.Error("mysql 5 should not support skip locked")
+	}
+}
@@ -0,0 +1,245 @@
+package kdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+fake is a in-memory database/sql driver for tests, it records executed statements
+by data source name and returns rows registered by fakeResult.
+*/
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+type fakeDB struct {
+	sync.Mutex
+	log     []string
+	args    [][]driver.Value
+	results map[string]*fakeRows
+}
+
+var _fakeDBs = struct {
+	sync.Mutex
+	dbs map[string]*fakeDB
+}{dbs: make(map[string]*fakeDB)}
+
+func getFakeDB(source string) *fakeDB {
+	_fakeDBs.Lock()
+	defer _fakeDBs.Unlock()
+
+	fdb, ok := _fakeDBs.dbs[source]
+	if !ok {
+		fdb = &fakeDB{results: make(map[string]*fakeRows)}
+		_fakeDBs.dbs[source] = fdb
+	}
+	return fdb
+}
+
+// fakeResult register rows that returned when query contains key
+func fakeResult(source string, key string, columns []string, values ...[]driver.Value) {
+	fdb := getFakeDB(source)
+	fdb.Lock()
+	fdb.results[key] = &fakeRows{columns: columns, values: values}
+	fdb.Unlock()
+}
+
+// fakeTable register schema of table for postgres and mssql dialect, pk is name of primary key column
+func fakeTable(source string, table string, pk string, columns ...string) {
+	tables := []string{"catalog", "schema", "name", "type"}
+	fakeResult(source, "information_schema.tables", tables, []driver.Value{"demo", "public", table, "BASE TABLE"})
+	fakeResult(source, "information_schema.[TABLES]", tables, []driver.Value{"demo", "dbo", table, "BASE TABLE"})
+
+	values := make([][]driver.Value, len(columns))
+	for i := 0; i < len(columns); i++ {
+		values[i] = []driver.Value{columns[i], int64(i + 1), true, "int", int64(0), int64(0), int64(0), false, false, columns[i] == pk}
+	}
+	cols := []string{"name", "position", "nullable", "datatype", "length", "precision", "scale", "autoincrement", "readonly", "primarykey"}
+	fakeResult(source, "information_schema.columns", cols, values...)
+	fakeResult(source, "[INFORMATION_SCHEMA].[COLUMNS]", cols, values...)
+}
+
+// fakeLog return statements executed on source
+func fakeLog(source string) []string {
+	fdb := getFakeDB(source)
+	fdb.Lock()
+	defer fdb.Unlock()
+	return append([]string(nil), fdb.log...)
+}
+
+// fakeArgs return args of statements executed on source, items are in same order as fakeLog
+func fakeArgs(source string) [][]driver.Value {
+	fdb := getFakeDB(source)
+	fdb.Lock()
+	defer fdb.Unlock()
+	return append([][]driver.Value(nil), fdb.args...)
+}
+
+// fakeReset clear log and results of source
+func fakeReset(source string) {
+	fdb := getFakeDB(source)
+	fdb.Lock()
+	fdb.log = nil
+	fdb.args = nil
+	fdb.results = make(map[string]*fakeRows)
+	fdb.Unlock()
+}
+
+func (fdb *fakeDB) record(query string, args ...driver.Value) {
+	fdb.Lock()
+	fdb.log = append(fdb.log, strings.TrimSpace(query))
+	fdb.args = append(fdb.args, args)
+	fdb.Unlock()
+}
+
+func (fdb *fakeDB) find(query string) *fakeRows {
+	fdb.Lock()
+	defer fdb.Unlock()
+	for k, rows := range fdb.results {
+		if strings.Contains(query, k) {
+			return rows
+		}
+	}
+	return &fakeRows{}
+}
+
+type fakeDriver struct{}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: getFakeDB(name)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return &fakeTx{db: c.db}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.record("COMMIT")
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK")
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+// CheckNamedValue accept sql.Out, other values are converted by database/sql
+func (s *fakeStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(sql.Out); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// Exec return rows affected 1, or count of rows of multi-row insert,
+// sql.Out parameters are set to values of first row registered by fakeResult in order
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.record(s.query, args...)
+	if strings.Contains(s.query, "fake_error") {
+		return nil, errors.New("fake error")
+	}
+	if rows := s.db.find(s.query); len(rows.values) > 0 {
+		index := 0
+		for i := 0; i < len(args); i++ {
+			out, ok := args[i].(sql.Out)
+			if !ok || index >= len(rows.values[0]) {
+				continue
+			}
+			dv := reflect.ValueOf(out.Dest).Elem()
+			if v := rows.values[0][index]; v != nil {
+				dv.Set(reflect.ValueOf(v).Convert(dv.Type()))
+			}
+			index++
+		}
+	}
+	if i := strings.Index(s.query, "VALUES"); i != -1 && strings.HasPrefix(s.query, "INSERT") {
+		return driver.RowsAffected(strings.Count(s.query[i:], "(")), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.record(s.query, args...)
+	if strings.Contains(s.query, "fake_error") {
+		return nil, errors.New("fake error")
+	}
+	return &fakeCursor{rows: s.db.find(s.query)}, nil
+}
+
+type fakeCursor struct {
+	rows  *fakeRows
+	index int
+}
+
+func (c *fakeCursor) Columns() []string {
+	return c.rows.columns
+}
+
+func (c *fakeCursor) Close() error {
+	return nil
+}
+
+func (c *fakeCursor) Next(dest []driver.Value) error {
+	if c.index >= len(c.rows.values) {
+		return io.EOF
+	}
+	copy(dest, c.rows.values[c.index])
+	c.index++
+	return nil
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+	RegisterDialecter("fake", PostgreSQLDialecter{})
+	RegisterCompiler("fake", PostgreSQL())
+
+	sql.Register("fakemssql", fakeDriver{})
+	RegisterDialecter("fakemssql", MssqlDialecter{})
+	RegisterCompiler("fakemssql", MSSQL())
+
+	sql.Register("fakemysql", fakeDriver{})
+	RegisterDialecter("fakemysql", MysqlDialecter{})
+	RegisterCompiler("fakemysql", MySql())
+
+	sql.Register("fakeoracle", fakeDriver{})
+	RegisterDialecter("fakeoracle", OracleSQLDialecter{})
+	RegisterCompiler("fakeoracle", Oracle())
+}
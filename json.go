@@ -0,0 +1,1096 @@
+package kdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sdming/kdb/ansi"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalOptions is options of decoding json expression
+type UnmarshalOptions struct {
+	// AllowSql allow raw sql, Sql and Text nodes and identifiers that aren't plain names,
+	// should be true only if json is trusted
+	AllowSql bool
+
+	// Columns is allowed column names (case insensitive), empty means any column
+	Columns []string
+
+	// Tables is allowed table names (case insensitive), empty means any table.
+	// common tables of with clause are allowed
+	Tables []string
+
+	// Funcs is allowed names of function and procedure (case insensitive) besides Func constants of package,
+	// any function is allowed if AllowSql is true
+	Funcs []string
+}
+
+// MarshalExpression return json of expression, values are encoded with type tags
+func MarshalExpression(exp Expression) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ce, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			data, err = nil, ce.err
+		}
+	}()
+
+	c := &jsonCodec{}
+	n := c.encode(exp)
+	if n == nil {
+		return nil, errors.New("expression is nil")
+	}
+	return json.Marshal(n)
+}
+
+// UnmarshalExpression decode json of expression returned by MarshalExpression,
+// raw sql and functions other than Func constants of package aren't allowed
+func UnmarshalExpression(data []byte) (Expression, error) {
+	return UnmarshalExpressionWithOptions(data, UnmarshalOptions{})
+}
+
+// UnmarshalTrustedExpression decode json of expression returned by MarshalExpression,
+// raw sql and any function are allowed, json should be trusted
+func UnmarshalTrustedExpression(data []byte) (Expression, error) {
+	return UnmarshalExpressionWithOptions(data, UnmarshalOptions{AllowSql: true})
+}
+
+// UnmarshalExpressionWithOptions decode json of expression and validate it with options
+func UnmarshalExpressionWithOptions(data []byte, options UnmarshalOptions) (exp Expression, err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+
+	var n *jsonNode
+	if err = d.Decode(&n); err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, errors.New("expression is null")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ce, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			exp, err = nil, ce.err
+		}
+	}()
+
+	c := &jsonCodec{options: options}
+	exp = c.decode(n)
+	c.checkTables(exp)
+	return exp, nil
+}
+
+// jsonNode is json of expression, Node is name of NodeType, other fields are used according to Node
+type jsonNode struct {
+	Node string `json:"node"`
+
+	Name      string          `json:"name,omitempty"`
+	Alias     string          `json:"alias,omitempty"`
+	Sql       string          `json:"sql,omitempty"`
+	Op        string          `json:"op,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Dir       ansi.Dir        `json:"dir,omitempty"`
+	Escape    string          `json:"escape,omitempty"`
+	Distinct  bool            `json:"distinct,omitempty"`
+	Recursive bool            `json:"recursive,omitempty"`
+	Offset    int             `json:"offset,omitempty"`
+	Count     int             `json:"count,omitempty"`
+	Mode      string          `json:"mode,omitempty"`
+	Wait      string          `json:"wait,omitempty"`
+	Columns   []string        `json:"columns,omitempty"`
+	Keys      []string        `json:"keys,omitempty"`
+	Of        []string        `json:"of,omitempty"`
+
+	Exp         *jsonNode   `json:"exp,omitempty"`
+	Left        *jsonNode   `json:"left,omitempty"`
+	Right       *jsonNode   `json:"right,omitempty"`
+	High        *jsonNode   `json:"high,omitempty"`
+	Args        []*jsonNode `json:"args,omitempty"`
+	Conditions  []*jsonNode `json:"conditions,omitempty"`
+	Whens       []*jsonWhen `json:"whens,omitempty"`
+	Else        *jsonNode   `json:"else,omitempty"`
+	PartitionBy []*jsonNode `json:"partitionBy,omitempty"`
+	Frame       *jsonFrame  `json:"frame,omitempty"`
+
+	With       *jsonNode        `json:"with,omitempty"`
+	Tables     []*jsonWithTable `json:"tables,omitempty"`
+	Table      *jsonNode        `json:"table,omitempty"`
+	Sets       []*jsonNode      `json:"sets,omitempty"`
+	Rows       [][]*jsonNode    `json:"rows,omitempty"`
+	Select     *jsonNode        `json:"select,omitempty"`
+	Fields     []*jsonField     `json:"fields,omitempty"`
+	From       *jsonNode        `json:"from,omitempty"`
+	More       []*jsonNode      `json:"more,omitempty"`
+	Joins      []*jsonNode      `json:"joins,omitempty"`
+	Where      *jsonNode        `json:"where,omitempty"`
+	GroupBy    *jsonNode        `json:"groupBy,omitempty"`
+	Having     *jsonNode        `json:"having,omitempty"`
+	OrderBy    *jsonNode        `json:"orderBy,omitempty"`
+	Lock       *jsonNode        `json:"lock,omitempty"`
+	Output     *jsonNode        `json:"output,omitempty"`
+	Query      *jsonNode        `json:"query,omitempty"`
+	Queries    []*jsonCompound  `json:"queries,omitempty"`
+	Parameters []*jsonNode      `json:"parameters,omitempty"`
+}
+
+// jsonField is field of select, group by or order by
+type jsonField struct {
+	Exp   *jsonNode `json:"exp"`
+	Alias string    `json:"alias,omitempty"`
+	Dir   string    `json:"dir,omitempty"`
+}
+
+// jsonWhen is WHEN ... THEN ... of case
+type jsonWhen struct {
+	Value      *jsonNode   `json:"value,omitempty"`
+	Conditions []*jsonNode `json:"conditions,omitempty"`
+	Result     *jsonNode   `json:"result"`
+}
+
+// jsonFrame is frame of window
+type jsonFrame struct {
+	Unit  string `json:"unit"`
+	Start string `json:"start"`
+	End   string `json:"end,omitempty"`
+}
+
+// jsonWithTable is common table of with clause
+type jsonWithTable struct {
+	Name    string    `json:"name"`
+	Columns []string  `json:"columns,omitempty"`
+	Query   *jsonNode `json:"query"`
+}
+
+// jsonCompound is a query combined to compound query
+type jsonCompound struct {
+	Op    string    `json:"op"`
+	Query *jsonNode `json:"query"`
+}
+
+// jsonTypedValue is item of list value
+type jsonTypedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// value type tags other than names of reflect.Kind
+const (
+	jsonTypeNil   = "nil"
+	jsonTypeBytes = "bytes"
+	jsonTypeTime  = "time"
+	jsonTypeList  = "list"
+	jsonTypeSlice = "[]"
+)
+
+var _jsonBasicTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"int":     reflect.TypeOf(int(0)),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+}
+
+var _jsonNodeTypes = []NodeType{
+	NodeText, NodeProcedure, NodeInsert, NodeQuery, NodeUpdate, NodeDelete, NodeUpsert, NodeCompound,
+	NodeNull, NodeValue, NodeSql,
+	NodeTable, NodeColumn, NodeCondition, NodeSet, NodeAggregate, NodeCall, NodeCase, NodeWindow,
+	NodeSelect, NodeFrom, NodeJoin, NodeWhere, NodeGroupBy, NodeHaving, NodeOrderBy, NodeOutput, NodeWith, NodeLock,
+	NodeOperator, NodeFunc, NodeParameter,
+}
+
+var _jsonOperators = []Operator{
+	IsNull, IsNotNull, LessThan, LessOrEquals, GreaterThan, GreaterOrEquals, Equals, NotEquals,
+	Like, NotLike, Between, NotBetween, IsDistinctFrom, IsNotDistinct, In, NotIn, Exists, NotExists,
+	All, Some, Any, And, Or, OpenParentheses, CloseParentheses,
+}
+
+// _jsonFuncs is functions allowed by default
+var _jsonFuncs = []string{
+	string(Count), string(Sum), string(Avg), string(Min), string(Max),
+	string(CurrentTime), string(Coalesce), string(Lower), string(Upper), string(Substring), string(Concat),
+	string(RowNumber), string(Rank), string(DenseRank), string(Lag), string(Lead), string(FirstValue), string(LastValue),
+}
+
+var _jsonIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
+// jsonCodec encode expression to jsonNode and decode jsonNode to expression
+type jsonCodec struct {
+	options UnmarshalOptions
+}
+
+// throw abort encoding or decoding with an error
+func (c *jsonCodec) throw(message string) {
+	panic(compileError{err: errors.New(message)})
+}
+
+// isNilExpression return true if exp is nil or a nil pointer
+func isNilExpression(exp Expression) bool {
+	if exp == nil {
+		return true
+	}
+	v := reflect.ValueOf(exp)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func (c *jsonCodec) encode(exp Expression) *jsonNode {
+	if isNilExpression(exp) {
+		return nil
+	}
+
+	n := &jsonNode{Node: exp.Node().String()}
+	switch exp := exp.(type) {
+	case Null:
+	case Sql:
+		n.Sql = string(exp)
+	case Column:
+		n.Name = string(exp)
+	case *Column:
+		n.Name = string(*exp)
+	case Operator:
+		n.Op = string(exp)
+	case Func:
+		n.Name = string(exp)
+	case *Value:
+		n.Type, n.Value = c.encodeValue(exp.Value)
+	case *Parameter:
+		n.Name, n.Dir = exp.Name, exp.Dir
+		n.Type, n.Value = c.encodeValue(exp.Value)
+	case *Set:
+		n.Name, n.Exp = string(exp.Column), c.encode(exp.Value)
+	case *Condition:
+		n.Op, n.Escape = string(exp.Op), exp.Escape
+		n.Left, n.Right, n.High = c.encode(exp.Left), c.encode(exp.Right), c.encode(exp.High)
+	case *Aggregate:
+		n.Name, n.Exp = string(exp.Name), c.encode(exp.Exp)
+	case *Call:
+		n.Name, n.Args = string(exp.Name), c.encodeList(exp.Args)
+	case *Case:
+		n.Exp, n.Else = c.encode(exp.Exp), c.encode(exp.Else)
+		for i := 0; i < len(exp.Whens); i++ {
+			w := exp.Whens[i]
+			n.Whens = append(n.Whens, &jsonWhen{Value: c.encode(w.Value), Conditions: c.encodeConditions(w.Conditions), Result: c.encode(w.Result)})
+		}
+	case *Window:
+		n.Exp, n.PartitionBy, n.OrderBy = c.encode(exp.Func), c.encodeList(exp.PartitionBy), c.encode(exp.OrderBy)
+		if exp.Frame != nil {
+			n.Frame = &jsonFrame{Unit: string(exp.Frame.Unit), Start: string(exp.Frame.Start), End: string(exp.Frame.End)}
+		}
+	case *Where:
+		n.Conditions = c.encodeConditions(exp.Conditions)
+	case *Having:
+		n.Conditions = c.encodeConditions(exp.Conditions)
+	case *GroupBy:
+		for i := 0; i < len(exp.Fields); i++ {
+			n.Fields = append(n.Fields, &jsonField{Exp: c.encode(exp.Fields[i])})
+		}
+	case *Table:
+		n.Name, n.Alias, n.Query = exp.Name, exp.Alias, c.encode(exp.Query)
+	case *Select:
+		for i := 0; i < len(exp.Fields); i++ {
+			n.Fields = append(n.Fields, &jsonField{Exp: c.encode(exp.Fields[i].Exp), Alias: exp.Fields[i].Alias})
+		}
+	case *OrderBy:
+		for i := 0; i < len(exp.Fields); i++ {
+			n.Fields = append(n.Fields, &jsonField{Exp: c.encode(exp.Fields[i].Exp), Dir: string(exp.Fields[i].Direction)})
+		}
+	case *From:
+		n.Table = c.encode(exp.Table)
+		for i := 0; i < len(exp.Tables); i++ {
+			n.More = append(n.More, c.encode(exp.Tables[i]))
+		}
+		for i := 0; i < len(exp.Joins); i++ {
+			n.Joins = append(n.Joins, c.encode(exp.Joins[i]))
+		}
+	case *Join:
+		n.Op, n.Left, n.Right = string(exp.JoinType), c.encode(exp.Left), c.encode(exp.Right)
+		n.Conditions = c.encodeConditions(exp.Conditions)
+	case *Output:
+		n.Columns = columnNames(exp.Columns)
+	case *With:
+		n.Recursive = exp.Recursive
+		for i := 0; i < len(exp.Tables); i++ {
+			ct := exp.Tables[i]
+			n.Tables = append(n.Tables, &jsonWithTable{Name: ct.Name, Columns: ct.Columns, Query: c.encode(ct.Query)})
+		}
+	case *Lock:
+		n.Mode, n.Wait, n.Of = string(exp.Mode), string(exp.Wait), exp.Of
+	case *Text:
+		n.Sql, n.Parameters = exp.Sql, c.encodeParameters(exp.Parameters)
+	case *Procedure:
+		n.Name, n.Parameters = exp.Name, c.encodeParameters(exp.Parameters)
+	case *Insert:
+		n.Table, n.Sets, n.Query, n.Output = c.encode(exp.Table), c.encodeSets(exp.Sets), c.encode(exp.Query), c.encode(exp.Output)
+		n.Columns = columnNames(exp.Columns)
+		for i := 0; i < len(exp.Rows); i++ {
+			n.Rows = append(n.Rows, c.encodeList(exp.Rows[i]))
+		}
+	case *Upsert:
+		n.Table, n.Sets, n.Keys = c.encode(exp.Table), c.encodeSets(exp.Sets), columnNames(exp.Keys)
+	case *Update:
+		n.With, n.Table, n.Sets, n.From = c.encode(exp.With), c.encode(exp.Table), c.encodeSets(exp.Sets), c.encode(exp.From)
+		n.Where, n.OrderBy, n.Count, n.Output = c.encode(exp.Where), c.encode(exp.OrderBy), exp.Count, c.encode(exp.Output)
+	case *Delete:
+		n.With, n.Table, n.From = c.encode(exp.With), c.encode(exp.Table), c.encode(exp.From)
+		n.Where, n.OrderBy, n.Count, n.Output = c.encode(exp.Where), c.encode(exp.OrderBy), exp.Count, c.encode(exp.Output)
+	case *Query:
+		n.With, n.Distinct, n.Select, n.From = c.encode(exp.With), exp.IsDistinct, c.encode(exp.Select), c.encode(exp.From)
+		n.Where, n.GroupBy, n.Having, n.OrderBy = c.encode(exp.Where), c.encode(exp.GroupBy), c.encode(exp.Having), c.encode(exp.OrderBy)
+		n.Offset, n.Count, n.Lock = exp.Offset, exp.Count, c.encode(exp.Lock)
+	case *Compound:
+		n.With, n.Query, n.OrderBy = c.encode(exp.With), c.encode(exp.Query), c.encode(exp.OrderBy)
+		n.Offset, n.Count = exp.Offset, exp.Count
+		for i := 0; i < len(exp.Queries); i++ {
+			n.Queries = append(n.Queries, &jsonCompound{Op: string(exp.Queries[i].Operator), Query: c.encode(exp.Queries[i].Query)})
+		}
+	default:
+		c.throw(fmt.Sprintf("doesn't support expression type:%T", exp))
+	}
+	return n
+}
+
+func (c *jsonCodec) encodeList(list []Expression) []*jsonNode {
+	if len(list) == 0 {
+		return nil
+	}
+	nodes := make([]*jsonNode, len(list))
+	for i := 0; i < len(list); i++ {
+		if nodes[i] = c.encode(list[i]); nodes[i] == nil {
+			c.throw("expression in list is nil")
+		}
+	}
+	return nodes
+}
+
+func (c *jsonCodec) encodeConditions(conditions *Conditions) []*jsonNode {
+	if conditions == nil {
+		return nil
+	}
+	return c.encodeList(conditions.Conditions)
+}
+
+func (c *jsonCodec) encodeSets(sets []*Set) []*jsonNode {
+	nodes := make([]*jsonNode, 0, len(sets))
+	for i := 0; i < len(sets); i++ {
+		nodes = append(nodes, c.encode(sets[i]))
+	}
+	return nodes
+}
+
+func (c *jsonCodec) encodeParameters(ps []*Parameter) []*jsonNode {
+	nodes := make([]*jsonNode, 0, len(ps))
+	for i := 0; i < len(ps); i++ {
+		nodes = append(nodes, c.encode(ps[i]))
+	}
+	return nodes
+}
+
+// encodeValue return type tag and json of value
+func (c *jsonCodec) encodeValue(v interface{}) (string, json.RawMessage) {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return jsonTypeNil, nil
+	}
+
+	var typ string
+	var value interface{}
+
+	if t, ok := rv.Interface().(time.Time); ok {
+		typ, value = jsonTypeTime, t.Format(time.RFC3339Nano)
+	} else if t, ok := _jsonBasicTypes[rv.Kind().String()]; ok {
+		typ, value = rv.Kind().String(), rv.Convert(t).Interface()
+	} else if rv.Kind() != reflect.Slice {
+		c.throw(fmt.Sprintf("doesn't support value type:%T", v))
+	} else if kind := rv.Type().Elem().Kind(); kind == reflect.Uint8 {
+		typ, value = jsonTypeBytes, rv.Bytes()
+	} else if kind == reflect.Interface {
+		list := make([]jsonTypedValue, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list[i].Type, list[i].Value = c.encodeValue(rv.Index(i).Interface())
+		}
+		typ, value = jsonTypeList, list
+	} else if t, ok := _jsonBasicTypes[kind.String()]; ok {
+		items := reflect.MakeSlice(reflect.SliceOf(t), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			items.Index(i).Set(rv.Index(i).Convert(t))
+		}
+		typ, value = jsonTypeSlice+kind.String(), items.Interface()
+	} else {
+		c.throw(fmt.Sprintf("doesn't support value type:%T", v))
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.throw(err.Error())
+	}
+	return typ, data
+}
+
+// decodeValue return value of type tag and json
+func (c *jsonCodec) decodeValue(typ string, data json.RawMessage) interface{} {
+	if typ == jsonTypeNil {
+		return nil
+	}
+	if len(data) == 0 {
+		c.throw("value is missing:" + typ)
+	}
+
+	switch typ {
+	case jsonTypeTime:
+		var s string
+		c.unmarshal(data, &s)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			c.throw("invalid time value:" + s)
+		}
+		return t
+	case jsonTypeBytes:
+		var b []byte
+		c.unmarshal(data, &b)
+		return b
+	case jsonTypeList:
+		var list []jsonTypedValue
+		c.unmarshal(data, &list)
+		values := make([]interface{}, len(list))
+		for i := 0; i < len(list); i++ {
+			values[i] = c.decodeValue(list[i].Type, list[i].Value)
+		}
+		return values
+	}
+
+	t, ok := _jsonBasicTypes[strings.TrimPrefix(typ, jsonTypeSlice)]
+	if !ok {
+		c.throw("unknown value type:" + typ)
+	}
+	if strings.HasPrefix(typ, jsonTypeSlice) {
+		t = reflect.SliceOf(t)
+	}
+	v := reflect.New(t)
+	c.unmarshal(data, v.Interface())
+	return v.Elem().Interface()
+}
+
+func (c *jsonCodec) unmarshal(data json.RawMessage, v interface{}) {
+	if err := json.Unmarshal(data, v); err != nil {
+		c.throw("invalid value:" + err.Error())
+	}
+}
+
+// nodeType return NodeType of name
+func (c *jsonCodec) nodeType(name string) NodeType {
+	for i := 0; i < len(_jsonNodeTypes); i++ {
+		if _jsonNodeTypes[i].String() == name {
+			return _jsonNodeTypes[i]
+		}
+	}
+	c.throw("unknown node:" + name)
+	return NodeZero
+}
+
+// expect throw if n isn't node of type t
+func (c *jsonCodec) expect(n *jsonNode, t NodeType) {
+	if n == nil {
+		c.throw("expect node:" + t.String())
+	}
+	if n.Node != t.String() {
+		c.throw("expect node " + t.String() + ":" + n.Node)
+	}
+}
+
+// identifier validate name of table, alias or function
+func (c *jsonCodec) identifier(name string) string {
+	if !c.options.AllowSql && !_jsonIdentifier.MatchString(name) {
+		c.throw("invalid identifier:" + name)
+	}
+	return name
+}
+
+// function validate name of function or procedure
+func (c *jsonCodec) function(name string) Func {
+	c.identifier(name)
+	if !c.options.AllowSql && !containsFold(_jsonFuncs, name) && !containsFold(c.options.Funcs, name) {
+		c.throw("function isn't allowed:" + name)
+	}
+	return Func(name)
+}
+
+// checkTables validate tables referenced by exp
+func (c *jsonCodec) checkTables(exp Expression) {
+	if len(c.options.Tables) == 0 {
+		return
+	}
+	tables := TablesReferenced(exp)
+	for i := 0; i < len(tables); i++ {
+		if !containsFold(c.options.Tables, tables[i]) {
+			c.throw("table isn't allowed:" + tables[i])
+		}
+	}
+}
+
+// column validate column name and return it
+func (c *jsonCodec) column(name string) Column {
+	if name == "" {
+		c.throw("column is empty")
+	}
+	if s := strings.TrimSuffix(name, ansi.Split+ansi.WildcardAll); !c.options.AllowSql &&
+		name != ansi.WildcardAll && !_jsonIdentifier.MatchString(s) {
+		c.throw("invalid column:" + name)
+	}
+
+	if len(c.options.Columns) == 0 {
+		return Column(name)
+	}
+	for i := 0; i < len(c.options.Columns); i++ {
+		if strings.EqualFold(c.options.Columns[i], name) {
+			return Column(name)
+		}
+	}
+	c.throw("column isn't allowed:" + name)
+	return ""
+}
+
+func (c *jsonCodec) columns(names []string) []Column {
+	columns := make([]Column, 0, len(names))
+	for i := 0; i < len(names); i++ {
+		columns = append(columns, c.column(names[i]))
+	}
+	return columns
+}
+
+// operator validate operator
+func (c *jsonCodec) operator(op string) Operator {
+	for i := 0; i < len(_jsonOperators); i++ {
+		if string(_jsonOperators[i]) == op {
+			return _jsonOperators[i]
+		}
+	}
+	c.throw("unknown operator:" + op)
+	return ""
+}
+
+// limit validate offset or count
+func (c *jsonCodec) limit(n int) int {
+	if n < 0 {
+		c.throw("offset or count is negative:" + strconv.Itoa(n))
+	}
+	return n
+}
+
+func (c *jsonCodec) decode(n *jsonNode) Expression {
+	if n == nil {
+		return nil
+	}
+
+	switch c.nodeType(n.Node) {
+	case NodeNull:
+		return DbNull
+	case NodeSql:
+		if !c.options.AllowSql && n.Sql != ansi.WildcardAll {
+			c.throw("raw sql isn't allowed")
+		}
+		return Sql(n.Sql)
+	case NodeColumn:
+		return c.column(n.Name)
+	case NodeOperator:
+		return c.operator(n.Op)
+	case NodeFunc:
+		return c.function(n.Name)
+	case NodeValue:
+		return &Value{Value: c.decodeValue(n.Type, n.Value)}
+	case NodeParameter:
+		return c.decodeParameter(n)
+	case NodeSet:
+		return c.decodeSet(n)
+	case NodeCondition:
+		return c.decodeCondition(n)
+	case NodeAggregate:
+		if n.Exp == nil {
+			c.throw("expression of aggregate is nil")
+		}
+		return NewAggregate(c.function(n.Name), c.decode(n.Exp))
+	case NodeCall:
+		return &Call{Name: c.function(n.Name), Args: c.decodeList(n.Args)}
+	case NodeCase:
+		return c.decodeCase(n)
+	case NodeWindow:
+		return c.decodeWindow(n)
+	case NodeWhere:
+		return &Where{c.decodeConditions(n.Conditions)}
+	case NodeHaving:
+		return &Having{c.decodeConditions(n.Conditions)}
+	case NodeGroupBy:
+		return c.decodeGroupBy(n)
+	case NodeTable:
+		return c.decodeTable(n)
+	case NodeSelect:
+		return c.decodeSelect(n)
+	case NodeOrderBy:
+		return c.decodeOrderBy(n)
+	case NodeFrom:
+		return c.decodeFrom(n)
+	case NodeJoin:
+		return c.decodeJoin(n)
+	case NodeOutput:
+		return &Output{Columns: c.columns(n.Columns)}
+	case NodeWith:
+		return c.decodeWith(n)
+	case NodeLock:
+		return c.decodeLock(n)
+	case NodeText:
+		if !c.options.AllowSql {
+			c.throw("raw sql isn't allowed")
+		}
+		return &Text{Sql: n.Sql, Parameters: c.decodeParameters(n.Parameters)}
+	case NodeProcedure:
+		return &Procedure{Name: string(c.function(n.Name)), Parameters: c.decodeParameters(n.Parameters)}
+	case NodeInsert:
+		return c.decodeInsert(n)
+	case NodeUpsert:
+		return c.decodeUpsert(n)
+	case NodeUpdate:
+		return c.decodeUpdate(n)
+	case NodeDelete:
+		return c.decodeDelete(n)
+	case NodeQuery:
+		return c.decodeQuery(n)
+	case NodeCompound:
+		return c.decodeCompound(n)
+	}
+
+	c.throw("unknown node:" + n.Node)
+	return nil
+}
+
+func (c *jsonCodec) decodeList(nodes []*jsonNode) []Expression {
+	list := make([]Expression, 0, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		if nodes[i] == nil {
+			c.throw("expression in list is null")
+		}
+		list = append(list, c.decode(nodes[i]))
+	}
+	return list
+}
+
+// decodeConditions return *Conditions, items are *Condition or AND, OR and parentheses
+func (c *jsonCodec) decodeConditions(nodes []*jsonNode) *Conditions {
+	conditions := newConditions()
+	deep := 0
+	for i := 0; i < len(nodes); i++ {
+		exp := c.decodeList(nodes[i : i+1])[0]
+		switch exp {
+		case And, Or:
+		case OpenParentheses:
+			deep++
+		case CloseParentheses:
+			if deep--; deep < 0 {
+				c.throw("unbalanced parentheses of conditions")
+			}
+		default:
+			if exp.Node() == NodeOperator {
+				c.throw("unexpected operator in conditions:" + fmt.Sprint(exp))
+			}
+		}
+		conditions.Conditions = append(conditions.Conditions, exp)
+	}
+	if deep != 0 {
+		c.throw("unbalanced parentheses of conditions")
+	}
+
+	if l := len(conditions.Conditions); l > 0 {
+		last := conditions.Conditions[l-1]
+		conditions.needLogicOperator = last != And && last != Or && last != OpenParentheses
+	}
+	return conditions
+}
+
+func (c *jsonCodec) decodeParameter(n *jsonNode) *Parameter {
+	c.expect(n, NodeParameter)
+	if n.Dir < ansi.DirIn || n.Dir > ansi.DirReturn {
+		c.throw("invalid direction of parameter:" + n.Name)
+	}
+	return &Parameter{Name: c.identifier(n.Name), Value: c.decodeValue(n.Type, n.Value), Dir: n.Dir}
+}
+
+func (c *jsonCodec) decodeParameters(nodes []*jsonNode) []*Parameter {
+	ps := make([]*Parameter, 0, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		ps = append(ps, c.decodeParameter(nodes[i]))
+	}
+	return ps
+}
+
+func (c *jsonCodec) decodeSet(n *jsonNode) *Set {
+	c.expect(n, NodeSet)
+	if n.Exp == nil {
+		c.throw("value of set is null:" + n.Name)
+	}
+	return &Set{Column: c.column(n.Name), Value: c.decode(n.Exp)}
+}
+
+func (c *jsonCodec) decodeSets(nodes []*jsonNode) []*Set {
+	sets := make([]*Set, 0, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		sets = append(sets, c.decodeSet(nodes[i]))
+	}
+	return sets
+}
+
+func (c *jsonCodec) decodeCondition(n *jsonNode) *Condition {
+	op := c.operator(n.Op)
+	switch op {
+	case And, Or, OpenParentheses, CloseParentheses:
+		c.throw("invalid operator of condition:" + n.Op)
+	}
+	if n.Left == nil && n.Right == nil {
+		c.throw("operand of condition is null:" + n.Op)
+	}
+	if (op == Between || op == NotBetween) != (n.High != nil) {
+		c.throw("upper bound of condition is invalid:" + n.Op)
+	}
+	if n.Escape != "" && ((op != Like && op != NotLike) || len([]rune(n.Escape)) != 1) {
+		c.throw("invalid escape of condition:" + n.Escape)
+	}
+	return &Condition{Op: op, Left: c.decode(n.Left), Right: c.decode(n.Right), High: c.decode(n.High), Escape: n.Escape}
+}
+
+func (c *jsonCodec) decodeCase(n *jsonNode) *Case {
+	cs := &Case{Exp: c.decode(n.Exp), Else: c.decode(n.Else), Whens: make([]*CaseWhen, 0, len(n.Whens))}
+	if len(n.Whens) == 0 {
+		c.throw("case has no when")
+	}
+	for i := 0; i < len(n.Whens); i++ {
+		w := n.Whens[i]
+		if w == nil || w.Result == nil {
+			c.throw("result of when is null")
+		}
+		if (cs.Exp == nil) == (w.Value != nil) || (w.Value == nil) == (len(w.Conditions) == 0) {
+			c.throw("when should be value of simple case or conditions of searched case")
+		}
+		when := &CaseWhen{Value: c.decode(w.Value), Result: c.decode(w.Result)}
+		if len(w.Conditions) > 0 {
+			when.Conditions = c.decodeConditions(w.Conditions)
+		}
+		cs.Whens = append(cs.Whens, when)
+	}
+	return cs
+}
+
+func (c *jsonCodec) decodeWindow(n *jsonNode) *Window {
+	if n.Exp == nil || (n.Exp.Node != NodeCall.String() && n.Exp.Node != NodeAggregate.String()) {
+		c.throw("function of window should be Call or Aggregate")
+	}
+	w := &Window{Func: c.decode(n.Exp), PartitionBy: c.decodeList(n.PartitionBy)}
+	if n.OrderBy != nil {
+		w.OrderBy = c.decodeOrderBy(n.OrderBy)
+	}
+	if n.Frame != nil {
+		w.Frame = &Frame{Unit: FrameUnit(n.Frame.Unit), Start: c.frameBound(n.Frame.Start), End: FrameBound(n.Frame.End)}
+		if w.Frame.Unit != FrameRows && w.Frame.Unit != FrameRange {
+			c.throw("invalid unit of frame:" + n.Frame.Unit)
+		}
+		if w.Frame.End != "" {
+			c.frameBound(n.Frame.End)
+		}
+	}
+	return w
+}
+
+// frameBound validate bound of frame
+func (c *jsonCodec) frameBound(s string) FrameBound {
+	b := FrameBound(s)
+	switch b {
+	case UnboundedPreceding, UnboundedFollowing, CurrentRow:
+		return b
+	}
+
+	for _, suffix := range []string{" PRECEDING", " FOLLOWING"} {
+		if strings.HasSuffix(s, suffix) {
+			if i, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); err == nil && i >= 0 {
+				return b
+			}
+		}
+	}
+	c.throw("invalid bound of frame:" + s)
+	return ""
+}
+
+func (c *jsonCodec) decodeGroupBy(n *jsonNode) *GroupBy {
+	c.expect(n, NodeGroupBy)
+	g := NewGroupBy()
+	for i := 0; i < len(n.Fields); i++ {
+		if n.Fields[i] == nil || n.Fields[i].Exp == nil {
+			c.throw("field of group by is null")
+		}
+		g.By(c.decode(n.Fields[i].Exp))
+	}
+	return g
+}
+
+func (c *jsonCodec) decodeTable(n *jsonNode) *Table {
+	c.expect(n, NodeTable)
+	t := &Table{Alias: n.Alias}
+	if t.Alias != "" {
+		c.identifier(t.Alias)
+	}
+	if n.Query != nil {
+		t.Query = c.decodeQuery(n.Query)
+	} else if n.Name == "" {
+		c.throw("name of table is empty")
+	} else {
+		t.Name = c.identifier(n.Name)
+	}
+	return t
+}
+
+func (c *jsonCodec) decodeSelect(n *jsonNode) *Select {
+	c.expect(n, NodeSelect)
+	s := NewSelect()
+	for i := 0; i < len(n.Fields); i++ {
+		f := n.Fields[i]
+		if f == nil || f.Exp == nil {
+			c.throw("field of select is null")
+		}
+		if f.Alias != "" {
+			c.identifier(f.Alias)
+		}
+		s.Exp(c.decode(f.Exp), f.Alias)
+	}
+	return s
+}
+
+func (c *jsonCodec) decodeOrderBy(n *jsonNode) *OrderBy {
+	c.expect(n, NodeOrderBy)
+	od := NewOrderBy()
+	for i := 0; i < len(n.Fields); i++ {
+		f := n.Fields[i]
+		if f == nil || f.Exp == nil {
+			c.throw("field of order by is null")
+		}
+		dir := SortDir(f.Dir)
+		if dir != Asc && dir != Desc {
+			c.throw("invalid direction of order by:" + f.Dir)
+		}
+		od.By(dir, c.decode(f.Exp))
+	}
+	return od
+}
+
+func (c *jsonCodec) decodeFrom(n *jsonNode) *From {
+	c.expect(n, NodeFrom)
+	f := &From{Table: c.decodeTable(n.Table)}
+	for i := 0; i < len(n.More); i++ {
+		f.ThenFromTable(c.decodeTable(n.More[i]))
+	}
+	for i := 0; i < len(n.Joins); i++ {
+		f.Join(c.decodeJoin(n.Joins[i]))
+	}
+	return f
+}
+
+func (c *jsonCodec) decodeJoin(n *jsonNode) *Join {
+	c.expect(n, NodeJoin)
+	joinType := JoinType(n.Op)
+	switch joinType {
+	case CrossJoin, InnerJoin, LeftJoin, RightJoin:
+	default:
+		c.throw("unknown join type:" + n.Op)
+	}
+	return &Join{JoinType: joinType, Left: c.decodeTable(n.Left), Right: c.decodeTable(n.Right), Conditions: c.decodeConditions(n.Conditions)}
+}
+
+func (c *jsonCodec) decodeWith(n *jsonNode) *With {
+	c.expect(n, NodeWith)
+	w := NewWith()
+	w.Recursive = n.Recursive
+	for i := 0; i < len(n.Tables); i++ {
+		ct := n.Tables[i]
+		if ct == nil || ct.Query == nil {
+			c.throw("query of common table is null")
+		}
+		for j := 0; j < len(ct.Columns); j++ {
+			c.identifier(ct.Columns[j])
+		}
+		w.Table(c.identifier(ct.Name), c.decodeSubQuery(ct.Query), ct.Columns...)
+	}
+	return w
+}
+
+func (c *jsonCodec) decodeLock(n *jsonNode) *Lock {
+	c.expect(n, NodeLock)
+	l := &Lock{Mode: LockMode(n.Mode), Wait: LockWait(n.Wait), Of: n.Of}
+	if l.Mode != ForUpdate && l.Mode != ForShare {
+		c.throw("unknown lock mode:" + n.Mode)
+	}
+	if l.Wait != Wait && l.Wait != NoWait && l.Wait != SkipLocked {
+		c.throw("unknown lock wait:" + n.Wait)
+	}
+	for i := 0; i < len(l.Of); i++ {
+		c.identifier(l.Of[i])
+	}
+	return l
+}
+
+// decodeSubQuery return *Query or *Compound
+func (c *jsonCodec) decodeSubQuery(n *jsonNode) Expression {
+	if n != nil && n.Node == NodeCompound.String() {
+		return c.decodeCompound(n)
+	}
+	return c.decodeQuery(n)
+}
+
+func (c *jsonCodec) decodeOutput(n *jsonNode) *Output {
+	if n == nil {
+		return nil
+	}
+	c.expect(n, NodeOutput)
+	return &Output{Columns: c.columns(n.Columns)}
+}
+
+func (c *jsonCodec) decodeWhere(n *jsonNode) *Where {
+	if n == nil {
+		return NewWhere()
+	}
+	c.expect(n, NodeWhere)
+	return &Where{c.decodeConditions(n.Conditions)}
+}
+
+func (c *jsonCodec) decodeInsert(n *jsonNode) *Insert {
+	ist := &Insert{Table: c.decodeTable(n.Table), Sets: c.decodeSets(n.Sets), Output: c.decodeOutput(n.Output)}
+	for i := 0; i < len(n.Rows); i++ {
+		if len(n.Rows[i]) != len(ist.Sets) {
+			c.throw("values of row don't match sets")
+		}
+		ist.Rows = append(ist.Rows, c.decodeList(n.Rows[i]))
+	}
+	if n.Query != nil {
+		if len(ist.Sets) > 0 {
+			c.throw("insert has both sets and query")
+		}
+		ist.Query, ist.Columns = c.decodeSubQuery(n.Query), c.columns(n.Columns)
+	}
+	return ist
+}
+
+func (c *jsonCodec) decodeUpsert(n *jsonNode) *Upsert {
+	return &Upsert{Table: c.decodeTable(n.Table), Sets: c.decodeSets(n.Sets), Keys: c.columns(n.Keys)}
+}
+
+func (c *jsonCodec) decodeUpdate(n *jsonNode) *Update {
+	u := &Update{Table: c.decodeTable(n.Table), Sets: c.decodeSets(n.Sets), Where: c.decodeWhere(n.Where),
+		OrderBy: &OrderBy{}, Count: c.limit(n.Count), Output: c.decodeOutput(n.Output)}
+	if n.With != nil {
+		u.With = c.decodeWith(n.With)
+	}
+	if n.From != nil {
+		u.From = c.decodeFrom(n.From)
+	}
+	if n.OrderBy != nil {
+		u.OrderBy = c.decodeOrderBy(n.OrderBy)
+	}
+	return u
+}
+
+func (c *jsonCodec) decodeDelete(n *jsonNode) *Delete {
+	d := &Delete{Table: c.decodeTable(n.Table), Where: c.decodeWhere(n.Where),
+		OrderBy: NewOrderBy(), Count: c.limit(n.Count), Output: c.decodeOutput(n.Output)}
+	if n.With != nil {
+		d.With = c.decodeWith(n.With)
+	}
+	if n.From != nil {
+		d.From = c.decodeFrom(n.From)
+	}
+	if n.OrderBy != nil {
+		d.OrderBy = c.decodeOrderBy(n.OrderBy)
+	}
+	return d
+}
+
+func (c *jsonCodec) decodeQuery(n *jsonNode) *Query {
+	c.expect(n, NodeQuery)
+	q := &Query{Select: NewSelect(), Where: c.decodeWhere(n.Where), IsDistinct: n.Distinct,
+		Offset: c.limit(n.Offset), Count: c.limit(n.Count)}
+	if n.With != nil {
+		q.With = c.decodeWith(n.With)
+	}
+	if n.Select != nil {
+		q.Select = c.decodeSelect(n.Select)
+	}
+	if n.From != nil {
+		q.From = c.decodeFrom(n.From)
+	}
+	if n.GroupBy != nil {
+		q.GroupBy = c.decodeGroupBy(n.GroupBy)
+	}
+	if n.Having != nil {
+		c.expect(n.Having, NodeHaving)
+		q.Having = &Having{c.decodeConditions(n.Having.Conditions)}
+	}
+	if n.OrderBy != nil {
+		q.OrderBy = c.decodeOrderBy(n.OrderBy)
+	}
+	if n.Lock != nil {
+		q.Lock = c.decodeLock(n.Lock)
+	}
+	return q
+}
+
+func (c *jsonCodec) decodeCompound(n *jsonNode) *Compound {
+	c.expect(n, NodeCompound)
+	cp := NewCompound(c.decodeQuery(n.Query))
+	cp.Offset, cp.Count = c.limit(n.Offset), c.limit(n.Count)
+	for i := 0; i < len(n.Queries); i++ {
+		cq := n.Queries[i]
+		if cq == nil {
+			c.throw("query of compound is null")
+		}
+		op := SetOperator(cq.Op)
+		if op != Union && op != UnionAll && op != Intersect && op != Except {
+			c.throw("unknown set operator:" + cq.Op)
+		}
+		cp.Combine(op, c.decodeQuery(cq.Query))
+	}
+	if n.OrderBy != nil {
+		cp.OrderBy = c.decodeOrderBy(n.OrderBy)
+	}
+	if n.With != nil {
+		cp.With = c.decodeWith(n.With)
+	}
+	return cp
+}
+
+// columnNames return names of columns
+func columnNames(columns []Column) []string {
+	if len(columns) == 0 {
+		return nil
+	}
+	names := make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		names[i] = string(columns[i])
+	}
+	return names
+}
@@ -0,0 +1,185 @@
+package kdb
+
+import (
+	"github.com/sdming/kdb/ansi"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func jsonTestExpressions() []Expression {
+	sub := NewQuery("orders", "")
+	sub.Select.Column("person_id")
+	sub.Where.GreaterThan("amount", 10.5)
+
+	q := NewQuery("person", "p")
+	q.Select.Column("p.id", "p.name").ColumnAs("p.age", "years").Count("*", "cnt").
+		Exp(NewCall(Coalesce, Column("p.nick"), "none"), "nick").
+		Exp(NewCase().When(GreaterThan, "p.age", 60, "old").OrElse("young"), "grade").
+		Exp(NewWindow(NewAggregate(Sum, Column("p.age"))).Partition("p.city").Rows(Preceding(2), CurrentRow), "rn")
+	q.From.LeftJoin("city", "c").On("p.city", "c.id")
+	q.Where.Equals("p.deleted", false).OpenParentheses().
+		Between("p.age", 18, int64(65)).Or().LikeEscape("p.name", "a!%", "!").CloseParentheses().
+		In("p.id", sub).In("p.level", []int{1, 2}).IsNotNull("p.email").
+		GreaterOrEquals("p.created", time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)).
+		NullSafeNotEquals("p.token", []byte("abc")).NotIn("p.tag", []interface{}{"x", 1, nil})
+	q.UseGroupBy().Column("p.id", "p.name", "p.age")
+	q.UseHaving().Count(GreaterThan, "p.id", 1)
+	q.UseOrderBy().Desc("p.age").Asc("p.name")
+	q.Distinct().Limit(10, 20)
+
+	cte := NewQuery("person", "")
+	cte.Where.Equals("age", uint8(1))
+	q.UseWith().Table("young", cte, "id", "name")
+
+	locked := NewQuery("person", "")
+	locked.ForUpdate(SkipLocked, "person")
+
+	compound := NewCompound(NewQuery("a", "")).Union(NewQuery("b", "")).Except(NewQuery("c", "")).Limit(0, 5)
+	compound.UseOrderBy().Asc("id")
+
+	insert := NewInsert("person").Set("name", "a").Set("age", 1).Row("b", 2).Returning("id")
+	insertSelect := NewInsert("person_copy").Select(NewQuery("person", ""), "id", "name")
+
+	update := NewUpdate("person").As("p").Set("age", 2).Set("updated", NewCall(CurrentTime))
+	update.UseFrom("city", "c")
+	update.Where.Sql("p.city = c.id").Equals("c.name", "x")
+
+	del := NewDelete("person").Returning("id")
+	del.Where.IsNull("email")
+	del.UseOrderBy().Asc("id")
+
+	upsert := NewUpsert("person", "id").Set("id", 1).Set("name", "a")
+	text := NewText("select * from person where id = @id").Set("id", float32(1.5))
+	procedure := NewProcedure("sp_person").SetDir("id", 1, ansi.DirInOut)
+
+	return []Expression{q, locked, compound, insert, insertSelect, update, del, upsert, text, procedure}
+}
+
+func TestJsonExpression(t *testing.T) {
+	driver := NewSqlDriver(PostgreSQLDialecter{})
+
+	for _, exp := range jsonTestExpressions() {
+		data, err := MarshalExpression(exp)
+		if err != nil {
+			t.Fatal("marshal expression error", exp.Node(), err)
+		}
+
+		decoded, err := UnmarshalTrustedExpression(data)
+		if err != nil {
+			t.Fatal("unmarshal expression error", exp.Node(), err, string(data))
+		}
+		if reflect.TypeOf(decoded) != reflect.TypeOf(exp) {
+			t.Errorf("unmarshal expression type error; want=[%T]; actual=[%T]", exp, decoded)
+			continue
+		}
+
+		again, err := MarshalExpression(decoded)
+		if err != nil || string(again) != string(data) {
+			t.Error("marshal expression isn't stable", err, "\n", string(data), "\n", string(again))
+		}
+
+		switch exp.Node() {
+		case NodeText, NodeProcedure:
+			continue
+		}
+		want, wantArgs, err := driver.Compile("source", exp)
+		if err != nil {
+			t.Fatal("compile expression error", exp.Node(), err)
+		}
+		query, args, err := driver.Compile("source", decoded)
+		if err != nil || query != want {
+			t.Error("compile decoded expression error", err, "\n", query, "\n", want)
+		}
+		if !reflect.DeepEqual(args, wantArgs) {
+			t.Errorf("decoded expression args error; want=[%#v]; actual=[%#v]", wantArgs, args)
+		}
+	}
+}
+
+func TestJsonExpressionOptions(t *testing.T) {
+	q := NewQuery("person", "")
+	q.Select.All()
+	q.Where.Equals("age", 1).Sql("1 = 1")
+	data, _ := MarshalExpression(q)
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{}); err == nil {
+		t.Error("unmarshal raw sql should return error")
+	}
+	if _, err := UnmarshalExpression(data); err == nil {
+		t.Error("unmarshal raw sql by default should return error")
+	}
+	if _, err := UnmarshalTrustedExpression(data); err != nil {
+		t.Error("unmarshal trusted raw sql error", err)
+	}
+
+	q = NewQuery("person", "")
+	q.Select.Exp(NewCall("pg_sleep", 10), "x").Exp(NewCall(Coalesce, Column("nick"), "a"), "nick")
+	data, _ = MarshalExpression(q)
+	if _, err := UnmarshalExpression(data); err == nil {
+		t.Error("unmarshal function isn't allowed should return error")
+	}
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{Funcs: []string{"PG_SLEEP"}}); err != nil {
+		t.Error("unmarshal allowed function error", err)
+	}
+	data, _ = MarshalExpression(NewProcedure("sp_person"))
+	if _, err := UnmarshalExpression(data); err == nil {
+		t.Error("unmarshal procedure isn't allowed should return error")
+	}
+
+	sub := NewQuery("secret", "")
+	sub.Select.Column("id")
+	q = NewQuery("person", "")
+	q.Where.In("id", sub)
+	data, _ = MarshalExpression(q)
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{Tables: []string{"person"}}); err == nil {
+		t.Error("unmarshal table of sub query isn't allowed should return error")
+	}
+	q = NewQuery("young", "")
+	q.UseWith().Table("young", NewQuery("PERSON", ""))
+	data, _ = MarshalExpression(q)
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{Tables: []string{"person"}}); err != nil {
+		t.Error("unmarshal allowed tables and common tables error", err)
+	}
+
+	q = NewQuery("person", "")
+	q.Select.All()
+	q.Where.Equals("age", 1).Like("name", "a%")
+	data, _ = MarshalExpression(q)
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{Columns: []string{"AGE", "name"}}); err != nil {
+		t.Error("unmarshal allowed columns error", err)
+	}
+	if _, err := UnmarshalExpressionWithOptions(data, UnmarshalOptions{Columns: []string{"age"}}); err == nil {
+		t.Error("unmarshal column isn't allowed should return error")
+	}
+
+	w := NewWhere()
+	w.Equals("a", struct{}{})
+	if _, err := MarshalExpression(w); err == nil {
+		t.Error("marshal unsupported value should return error")
+	}
+
+	invalid := []string{
+		`null`,
+		`{"node":"Query","select":{"node":"Select"},"unknown":1}`,
+		`{"node":"Nothing"}`,
+		`{"node":"Query","from":{"node":"From","table":{"node":"Table","name":"t; drop table t"}}}`,
+		`{"node":"Query","from":{"node":"From","table":{"node":"Column","name":"t"}}}`,
+		`{"node":"Where","conditions":[{"node":"Condition","op":"==","left":{"node":"Column","name":"a"},"right":{"node":"Value","type":"int","value":1}}]}`,
+		`{"node":"Where","conditions":[{"node":"Operator","op":"("},{"node":"Condition","op":"=","left":{"node":"Column","name":"a"},"right":{"node":"Value","type":"int","value":1}}]}`,
+		`{"node":"Where","conditions":[{"node":"Condition","op":"=","left":{"node":"Column","name":"a"},"right":{"node":"Value","type":"int","value":"x"}}]}`,
+		`{"node":"Where","conditions":[{"node":"Condition","op":"=","left":{"node":"Column","name":"a"},"right":{"node":"Value","type":"map"}}]}`,
+		`{"node":"Where","conditions":[{"node":"Condition","op":"BETWEEN","left":{"node":"Column","name":"a"},"right":{"node":"Value","type":"int","value":1}}]}`,
+		`{"node":"OrderBy","fields":[{"exp":{"node":"Column","name":"a"},"dir":"UP"}]}`,
+		`{"node":"Query","offset":-1}`,
+		`{"node":"Query","lock":{"node":"Lock","mode":"FOR NOTHING"}}`,
+		`{"node":"Text","sql":"delete from person"}`,
+	}
+	for _, s := range invalid {
+		if _, err := UnmarshalExpressionWithOptions([]byte(s), UnmarshalOptions{}); err == nil {
+			t.Errorf("unmarshal expression should return error; json=[%s]", s)
+		} else if strings.Contains(err.Error(), "runtime error") {
+			t.Errorf("unmarshal expression panic; json=[%s]; err=[%v]", s, err)
+		}
+	}
+}
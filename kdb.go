@@ -70,5 +70,8 @@ func (m Map) Fields() []string {
 // ErrNoResult means rows doesn't have result
 var ErrNoResult = errors.New("rows no result")
 
+// ErrStop can be returned by callback of Each to stop iteration, Each returns nil then
+var ErrStop = errors.New("stop iteration")
+
 // ExplictSchema is true mean must use schema when insert/update
 var ExplictSchema = true
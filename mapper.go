@@ -0,0 +1,76 @@
+package kdb
+
+import (
+	"unicode"
+)
+
+// NameMapper map name of struct field to column name, tag option name overrides it.
+// column names are matched case-insensitively
+type NameMapper struct {
+	fn func(field string) string
+}
+
+// NewNameMapper return *NameMapper which map field name to column name by fn
+func NewNameMapper(fn func(field string) string) *NameMapper {
+	if fn == nil {
+		panic("kdb: NewNameMapper fn is nil")
+	}
+	return &NameMapper{fn: fn}
+}
+
+// ColumnName return column name of field
+func (m *NameMapper) ColumnName(field string) string {
+	return m.fn(field)
+}
+
+var (
+	// ExactMapper map field name to same column name, UserName -> UserName
+	ExactMapper = NewNameMapper(func(field string) string { return field })
+
+	// SnakeMapper map field name to snake case column name, UserName -> user_name, UserID -> user_id
+	SnakeMapper = NewNameMapper(snakeCase)
+
+	// CamelMapper map field name to camel case column name, UserName -> userName, ID -> id
+	CamelMapper = NewNameMapper(camelCase)
+)
+
+// DefaultNameMapper is name mapper used if DB.NameMapper is nil
+var DefaultNameMapper = ExactMapper
+
+// snakeCase convert name to snake case, HTTPServer -> http_server, Address2 -> address2
+func snakeCase(name string) string {
+	runes := []rune(name)
+	l := len(runes)
+	b := make([]rune, 0, l+4)
+
+	for i := 0; i < l; i++ {
+		r := runes[i]
+		if !unicode.IsUpper(r) {
+			b = append(b, r)
+			continue
+		}
+
+		if i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < l && unicode.IsLower(runes[i+1])) {
+				b = append(b, '_')
+			}
+		}
+		b = append(b, unicode.ToLower(r))
+	}
+	return string(b)
+}
+
+// camelCase convert name to camel case by lower leading upper case letters, HTTPServer -> httpServer, ID -> id
+func camelCase(name string) string {
+	runes := []rune(name)
+	l := len(runes)
+
+	for i := 0; i < l && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < l && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,141 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNameMapper(t *testing.T) {
+	data := []struct {
+		name  string
+		snake string
+		camel string
+	}{
+		{"UserName", "user_name", "userName"},
+		{"UserID", "user_id", "userID"},
+		{"ID", "id", "id"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"Address2", "address2", "address2"},
+		{"Field2Name", "field2_name", "field2Name"},
+		{"Snake_Case", "snake_case", "snake_Case"},
+		{"name", "name", "name"},
+	}
+
+	for _, d := range data {
+		if s := SnakeMapper.ColumnName(d.name); s != d.snake {
+			t.Errorf("snake case error; name=[%v]; want=[%v]; actual=[%v]", d.name, d.snake, s)
+		}
+		if s := CamelMapper.ColumnName(d.name); s != d.camel {
+			t.Errorf("camel case error; name=[%v]; want=[%v]; actual=[%v]", d.name, d.camel, s)
+		}
+		if s := ExactMapper.ColumnName(d.name); s != d.name {
+			t.Errorf("exact error; name=[%v]; actual=[%v]", d.name, s)
+		}
+	}
+}
+
+type tMappedUser struct {
+	UserID   int
+	UserName string
+	Email    string   "kdb:{name=mail}"
+	Home     tAddress "kdb:{prefix=home_}"
+}
+
+func TestNameMapperStruct(t *testing.T) {
+	si, err := parseStruct(reflect.TypeOf(tMappedUser{}), SnakeMapper)
+	if err != nil {
+		t.Fatal("parseStruct error", err)
+	}
+	var cols []string
+	for i := 0; i < len(si.fields); i++ {
+		cols = append(cols, si.fields[i].colName)
+	}
+	if want := []string{"user_id", "user_name", "mail", "home_city", "home_zipcode"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("snake columns error; want=[%v]; actual=[%v]", want, cols)
+	}
+
+	custom := NewNameMapper(func(field string) string { return "c_" + field })
+	e := EntityWith(custom, tMappedUser{UserID: 1})
+	if x, ok := e.Get("c_userid"); x != 1 || !ok {
+		t.Error("Get by custom mapper error", x, ok)
+	}
+	if _, ok := Entity(tMappedUser{}).Get("c_userid"); ok {
+		t.Error("Entity should use DefaultNameMapper")
+	}
+
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+	db.NameMapper = SnakeMapper
+
+	fakeTable(source, "tmapper", "", "user_id", "user_name", "mail")
+	if _, err = db.Insert("tmapper", Entity(tMappedUser{UserID: 1, UserName: "a"})); err != nil {
+		t.Fatal("Insert with name mapper error", err)
+	}
+	log := fakeLog(source)
+	if want := `INSERT INTO tmapper(user_id, user_name, mail) VALUES($1, $2, $3);`; removeSpace(log[len(log)-1]) != removeSpace(want) {
+		t.Errorf("Insert with name mapper statement error; actual=[%v]", log[len(log)-1])
+	}
+
+	if _, err = db.Update("tmapper", Entity(tMappedUser{UserName: "b"}), "user_id", "=", 1); err != nil {
+		t.Fatal("Update with name mapper error", err)
+	}
+	log = fakeLog(source)
+	if want := `UPDATE tmapper SET user_id=$1, user_name=$2, mail=$3 WHERE user_id = $4;`; removeSpace(log[len(log)-1]) != removeSpace(want) {
+		t.Errorf("Update with name mapper statement error; actual=[%v]", log[len(log)-1])
+	}
+
+	fakeResult(source, "RETURNING", []string{"user_id", "user_name"}, []driver.Value{int64(7), "x"})
+	del := NewDelete("tmapper").Returning("user_id", "user_name")
+	var users []tMappedUser
+	if err = db.ExecReturning(del, &users); err != nil {
+		t.Fatal("ExecReturning with name mapper error", err)
+	}
+	if len(users) != 1 || users[0].UserID != 7 || users[0].UserName != "x" {
+		t.Errorf("ExecReturning with name mapper result error; actual=[%v]", users)
+	}
+}
+
+func TestNameMapperRead(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+	db.NameMapper = SnakeMapper
+
+	fakeResult(source, "tmapper", []string{"user_id", "user_name"},
+		[]driver.Value{int64(1), "a"}, []driver.Value{int64(2), "b"}, []driver.Value{int64(3), "c"})
+
+	rows, err := db.Query("select * from tmapper")
+	if err != nil {
+		t.Fatal("Query error", err)
+	}
+	var users []tMappedUser
+	if err = db.Read(rows, &users); err != nil || len(users) != 3 || users[1].UserID != 2 || users[1].UserName != "b" {
+		t.Error("Read with name mapper error", err, users)
+	}
+
+	var u tMappedUser
+	var names []string
+	rows, _ = db.Query("select * from tmapper")
+	err = db.Each(rows, &u, func() error {
+		names = append(names, u.UserName)
+		if u.UserID == 2 {
+			return fmt.Errorf("found: %w", ErrStop)
+		}
+		return nil
+	})
+	if want := []string{"a", "b"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("Each with name mapper error; want=[%v]; actual=[%v]; err=[%v]", want, names, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin error", err)
+	}
+	defer tx.Rollback()
+	var ids []int
+	rows, _ = tx.Query("select * from tmapper")
+	if err = tx.Each(rows, &u, func() error { ids = append(ids, u.UserID); return nil }); err != nil || !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Error("Tx Each with name mapper error", err, ids)
+	}
+}
@@ -0,0 +1,414 @@
+package kdb
+
+import (
+	"errors"
+	"github.com/sdming/kdb/ansi"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxParseDepth is max nesting depth of parentheses in parsed expression
+const maxParseDepth = 32
+
+// ParseConditions parse a restricted sql boolean expression to *Conditions,
+// like "age > 30 and (name like 'a%' or city in ('x','y'))".
+// columns is allowed column names (case insensitive), literals are converted to bound values.
+// Supported predicates are =, <>, !=, <, <=, >, >=, [NOT] IN, [NOT] LIKE, [NOT] BETWEEN and IS [NOT] NULL,
+// combined by AND, OR and parentheses
+func ParseConditions(expr string, columns ...string) (*Conditions, error) {
+	p := &conditionParser{columns: columns}
+	return p.parse(expr)
+}
+
+// ParseConditionsOf parse a restricted sql boolean expression to *Conditions, columns are validated against table
+func ParseConditionsOf(expr string, table *ansi.DbTable) (*Conditions, error) {
+	if table == nil {
+		return nil, errors.New("table of conditions is nil")
+	}
+
+	columns := make([]string, 0, len(table.Columns)*2)
+	for i := 0; i < len(table.Columns); i++ {
+		name := table.Columns[i].Name
+		columns = append(columns, name, table.Name+ansi.Split+name)
+	}
+	return ParseConditions(expr, columns...)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// keyword return upper case text if token is an identifier
+func (t token) keyword() string {
+	if t.kind != tokenIdent {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// _parseOperators is compare operators allowed in conditions
+var _parseOperators = map[string]Operator{
+	"=":  Equals,
+	"<>": NotEquals,
+	"!=": NotEquals,
+	"<":  LessThan,
+	"<=": LessOrEquals,
+	">":  GreaterThan,
+	">=": GreaterOrEquals,
+}
+
+var _parseKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "LIKE": true, "BETWEEN": true,
+	"IS": true, "NULL": true, "TRUE": true, "FALSE": true,
+}
+
+// tokenize split expression to tokens
+func tokenize(expr string) ([]token, error) {
+	tokens := make([]token, 0, _defaultCapicity)
+	rs := []rune(expr)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case r == '\'':
+			start := i
+			buf := make([]rune, 0, _defaultCapicity)
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, errors.New("unterminated string at:" + strconv.Itoa(start))
+				}
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						buf = append(buf, '\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				buf = append(buf, rs[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(buf), pos: start})
+		case r == '=' || r == '<' || r == '>' || r == '!':
+			start := i
+			i++
+			if i < len(rs) && (rs[i] == '=' || (r == '<' && rs[i] == '>')) {
+				i++
+			}
+			op := string(rs[start:i])
+			if op == "!" {
+				return nil, errors.New("unexpected character at " + strconv.Itoa(start) + ":" + op)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == 'e' || rs[i] == 'E' ||
+				((rs[i] == '-' || rs[i] == '+') && (rs[i-1] == 'e' || rs[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(rs[start:i]), pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(rs) && (rs[i] == '_' || rs[i] == '.' || unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(rs[start:i]), pos: start})
+		default:
+			return nil, errors.New("unexpected character at " + strconv.Itoa(i) + ":" + string(r))
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(rs)})
+	return tokens, nil
+}
+
+// conditionParser is a recursive descent parser of boolean expression
+type conditionParser struct {
+	columns []string
+	tokens  []token
+	index   int
+	depth   int
+	c       *Conditions
+}
+
+func (p *conditionParser) parse(expr string) (conditions *Conditions, err error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errors.New("conditions expression is empty")
+	}
+
+	if p.tokens, err = tokenize(expr); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ce, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			conditions, err = nil, ce.err
+		}
+	}()
+
+	p.c = newConditions()
+	p.parseOr()
+	if t := p.peek(); t.kind != tokenEOF {
+		p.throw(t, "unexpected token")
+	}
+	return p.c, nil
+}
+
+// throw abort parsing with an error
+func (p *conditionParser) throw(t token, message string) {
+	text := t.text
+	if t.kind == tokenEOF {
+		text = "end of expression"
+	}
+	panic(compileError{err: errors.New(message + " at " + strconv.Itoa(t.pos) + ":" + text)})
+}
+
+func (p *conditionParser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *conditionParser) next() token {
+	t := p.tokens[p.index]
+	if t.kind != tokenEOF {
+		p.index++
+	}
+	return t
+}
+
+// accept consume next token if it's keyword
+func (p *conditionParser) accept(keyword string) bool {
+	if p.peek().keyword() == keyword {
+		p.index++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) expect(keyword string) {
+	if t := p.peek(); !p.accept(keyword) {
+		p.throw(t, "expect "+keyword)
+	}
+}
+
+// parseOr parse and [OR and]...
+func (p *conditionParser) parseOr() {
+	p.parseAnd()
+	for p.accept(ansi.Or) {
+		p.c.Or()
+		p.parseAnd()
+	}
+}
+
+// parseAnd parse primary [AND primary]...
+func (p *conditionParser) parseAnd() {
+	p.parsePrimary()
+	for p.accept(ansi.And) {
+		p.c.And()
+		p.parsePrimary()
+	}
+}
+
+// parsePrimary parse (expression) or predicate
+func (p *conditionParser) parsePrimary() {
+	t := p.peek()
+	if t.kind != tokenOpen {
+		p.parsePredicate()
+		return
+	}
+
+	p.depth++
+	if p.depth > maxParseDepth {
+		p.throw(t, "too many nested parentheses")
+	}
+	p.next()
+	p.c.OpenParentheses()
+	p.parseOr()
+	if t := p.next(); t.kind != tokenClose {
+		p.throw(t, "expect )")
+	}
+	p.c.CloseParentheses()
+	p.depth--
+}
+
+// parsePredicate parse column op value, [NOT] IN, [NOT] LIKE, [NOT] BETWEEN, IS [NOT] NULL
+func (p *conditionParser) parsePredicate() {
+	column := p.parseColumn()
+
+	t := p.next()
+	if t.kind == tokenOperator {
+		op, ok := _parseOperators[t.text]
+		if !ok {
+			p.throw(t, "unknown operator")
+		}
+		value := p.parseValue()
+		if value == nil {
+			p.throw(t, "compare with NULL, use IS NULL")
+		}
+		p.c.Compare(op, column, value)
+		return
+	}
+
+	switch t.keyword() {
+	case "IS":
+		if p.accept(ansi.Not) {
+			p.expect(ansi.Null)
+			p.c.IsNotNull(column)
+		} else {
+			p.expect(ansi.Null)
+			p.c.IsNull(column)
+		}
+		return
+	case "NOT":
+		t = p.next()
+		switch t.keyword() {
+		case "IN":
+			p.c.NotIn(column, p.parseList())
+		case "LIKE":
+			p.c.NotLike(column, p.parseString())
+		case "BETWEEN":
+			low, high := p.parseRange()
+			p.c.NotBetween(column, low, high)
+		default:
+			p.throw(t, "expect IN, LIKE or BETWEEN")
+		}
+		return
+	case "IN":
+		p.c.In(column, p.parseList())
+		return
+	case "LIKE":
+		p.c.Like(column, p.parseString())
+		return
+	case "BETWEEN":
+		low, high := p.parseRange()
+		p.c.Between(column, low, high)
+		return
+	}
+
+	p.throw(t, "expect operator")
+}
+
+// parseColumn parse column name and return allowed name of it
+func (p *conditionParser) parseColumn() string {
+	t := p.next()
+	if t.kind != tokenIdent || _parseKeywords[t.keyword()] {
+		p.throw(t, "expect column")
+	}
+
+	for i := 0; i < len(p.columns); i++ {
+		if strings.EqualFold(p.columns[i], t.text) {
+			return p.columns[i]
+		}
+	}
+	p.throw(t, "column isn't allowed")
+	return ""
+}
+
+// parseValue parse number, string, TRUE, FALSE or NULL, NULL returns nil
+func (p *conditionParser) parseValue() interface{} {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.text
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return i
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.throw(t, "invalid number")
+		}
+		return f
+	case tokenIdent:
+		switch t.keyword() {
+		case "TRUE":
+			return true
+		case "FALSE":
+			return false
+		case "NULL":
+			return nil
+		}
+	}
+	p.throw(t, "expect value")
+	return nil
+}
+
+// parseString parse a string literal
+func (p *conditionParser) parseString() string {
+	t := p.next()
+	if t.kind != tokenString {
+		p.throw(t, "expect string")
+	}
+	return t.text
+}
+
+// parseList parse (value, ...)
+func (p *conditionParser) parseList() []interface{} {
+	if t := p.next(); t.kind != tokenOpen {
+		p.throw(t, "expect (")
+	}
+
+	values := make([]interface{}, 0, _defaultCapicity)
+	for {
+		t := p.peek()
+		v := p.parseValue()
+		if v == nil {
+			p.throw(t, "NULL in list")
+		}
+		values = append(values, v)
+
+		t = p.next()
+		if t.kind == tokenClose {
+			return values
+		} else if t.kind != tokenComma {
+			p.throw(t, "expect , or )")
+		}
+	}
+}
+
+// parseRange parse low AND high of BETWEEN
+func (p *conditionParser) parseRange() (low, high interface{}) {
+	t := p.peek()
+	if low = p.parseValue(); low == nil {
+		p.throw(t, "NULL in between")
+	}
+	p.expect(ansi.And)
+	t = p.peek()
+	if high = p.parseValue(); high == nil {
+		p.throw(t, "NULL in between")
+	}
+	return
+}
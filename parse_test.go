@@ -0,0 +1,65 @@
+package kdb
+
+import (
+	"github.com/sdming/kdb/ansi"
+	"reflect"
+	"testing"
+)
+
+func TestParseConditions(t *testing.T) {
+	c, err := ParseConditions("age > 30 and (Name like 'a%' or city in ('x','y''z')) AND score between -1.5 and 2e3 and deleted is not null",
+		"age", "name", "city", "score", "deleted")
+	if err != nil {
+		t.Fatal("parse conditions error", err)
+	}
+
+	q := NewQuery("person", "")
+	q.Where.Equals("tenant", 7).Merge(c)
+
+	query, args, err := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q)
+	want := `SELECT * FROM person WHERE tenant = $1 AND ( age > $2 AND ( name LIKE $3 OR city IN ($4, $5) ) 
+		AND score BETWEEN $6 AND $7 AND deleted IS NOT NULL );`
+	if err != nil || removeSpace(query) != removeSpace(want) {
+		t.Error("compiled parsed conditions error", err, "\n", query, "\n", want)
+	}
+	wantArgs := []interface{}{7, int64(30), "a%", "x", "y'z", -1.5, float64(2000)}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("parsed conditions args error; want=[%v]; actual=[%v]", wantArgs, args)
+	}
+
+	c, err = ParseConditions("not_a <> 'x' or b != true and c not in (1, 2)", "not_a", "b", "c")
+	if err != nil {
+		t.Fatal("parse conditions error", err)
+	}
+	query, _, _ = NewSqlDriver(MysqlDialecter{}).Compile("source", &Query{Select: NewSelect(), From: NewFrom("t", ""), Where: &Where{c}})
+	if want := `SELECT * FROM t WHERE not_a <> ? OR b <> ? AND c NOT IN (?, ?);`; removeSpace(query) != removeSpace(want) {
+		t.Error("compiled parsed conditions error", "\n", query, "\n", want)
+	}
+
+	table := &ansi.DbTable{Name: "person", Columns: []ansi.DbColumn{{Name: "age"}, {Name: "name"}}}
+	if _, err := ParseConditionsOf("person.age >= 18 and name = 'x'", table); err != nil {
+		t.Error("parse conditions of table error", err)
+	}
+
+	invalid := []string{
+		"",
+		"age > 30 and",
+		"age > 30; drop table person",
+		"password = 'x'",
+		"age = null",
+		"age > (select 1)",
+		"(age > 1",
+		"age in ()",
+		"name like 1",
+		"age > 1 or 1 = 1",
+		"name = 'x",
+		"age between 1 or 2",
+		"age == 1",
+		"age =< 1",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseConditions(expr, "age", "name"); err == nil {
+			t.Errorf("parse conditions should return error; expr=[%s]", expr)
+		}
+	}
+}
@@ -5,10 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // Read iterate rows and scan value to dest. dest can be *[]T, *[]map, *[]sliece, *[]struct.
+// time.Time, []byte and sql.Scanner are supported as T and as struct field, NULL leaves zero value.
+// columns are mapped to struct fields by DefaultNameMapper
 func Read(rows *sql.Rows, dest interface{}) error {
+	return read(rows, dest, nil)
+}
+
+// read is Read which map columns to struct fields by mapper
+func read(rows *sql.Rows, dest interface{}, mapper *NameMapper) error {
 	if dest == nil {
 		return errors.New("dest is nil")
 	}
@@ -34,6 +42,20 @@ func Read(rows *sql.Rows, dest interface{}) error {
 	et := dv.Type().Elem()
 	ek := et.Kind()
 
+	if kind := scanKindOf(et); kind != scanDefault {
+		if len(cols) != 1 {
+			return fmt.Errorf("Elem type is %v, but rows has %v columns", et, len(cols))
+		}
+		for rows.Next() {
+			v := reflect.New(et)
+			if err = readValue(rows, v.Elem(), kind); err != nil {
+				return err
+			}
+			dv.Set(reflect.Append(dv, v.Elem()))
+		}
+		return nil
+	}
+
 	switch ek {
 	case reflect.Bool, reflect.String,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -179,18 +201,21 @@ func Read(rows *sql.Rows, dest interface{}) error {
 		return nil
 	case reflect.Struct:
 		var si *structInfo
-		si, err = getStructInfo(et)
+		si, err = getStructInfo(et, mapper)
 		if err != nil {
 			return err
 		}
-		fields := colsFields(cols, si)
+		plan := si.scanPlan(cols)
+		v := plan.dests()
 
+		// scan to appended elem directly, elem is removed if scan fails
 		for rows.Next() {
-			v := reflect.New(et)
-			if err = setStructValue(rows, v, fields); err != nil {
+			n := dv.Len()
+			dv.Set(reflect.Append(dv, reflect.Zero(et)))
+			if err = setStructValue(rows, dv.Index(n), plan, v); err != nil {
+				dv.SetLen(n)
 				return err
 			}
-			dv.Set(reflect.Append(dv, v.Elem()))
 		}
 		return nil
 
@@ -201,18 +226,19 @@ func Read(rows *sql.Rows, dest interface{}) error {
 		}
 
 		var si *structInfo
-		si, err = getStructInfo(elem)
+		si, err = getStructInfo(elem, mapper)
 		if err != nil {
 			return err
 		}
-		fields := colsFields(cols, si)
+		plan := si.scanPlan(cols)
+		v := plan.dests()
 
 		for rows.Next() {
-			v := reflect.New(elem)
-			if err = setStructValue(rows, v, fields); err != nil {
+			e := reflect.New(elem)
+			if err = setStructValue(rows, e, plan, v); err != nil {
 				return err
 			}
-			dv.Set(reflect.Append(dv, v))
+			dv.Set(reflect.Append(dv, e))
 		}
 		return nil
 
@@ -223,6 +249,107 @@ func Read(rows *sql.Rows, dest interface{}) error {
 	return fmt.Errorf("Read does not support dest %v", dest)
 }
 
+// Each scan rows to dest one row at a time and call fn after each row, dest is reused for all rows.
+// dest can be any dest of ReadRow, values of dest are reset to zero before each row,
+// pointers and types of map and slice elements are kept. iteration stops if fn returns error,
+// Each returns nil if the error is ErrStop. rows is always closed, error of rows.Err() is returned
+func Each(rows *sql.Rows, dest interface{}, fn func() error) error {
+	return each(rows, dest, fn, nil)
+}
+
+// each is Each which map columns to struct fields by mapper
+func each(rows *sql.Rows, dest interface{}, fn func() error, mapper *NameMapper) (err error) {
+	if rows == nil {
+		return errors.New("rows is nil")
+	}
+	defer rows.Close()
+
+	if dest == nil {
+		return errors.New("dest is nil")
+	}
+	if fn == nil {
+		return errors.New("fn is nil")
+	}
+
+	dv := reflect.ValueOf(dest)
+	if (dv.Kind() == reflect.Ptr || dv.Kind() == reflect.Map || dv.Kind() == reflect.Slice) && dv.IsNil() {
+		return fmt.Errorf("Each does not support nil dest %T", dest)
+	}
+
+	// struct is scanned by plan of columns directly
+	var plan *scanPlan
+	var v []interface{}
+	if dv.Kind() == reflect.Ptr && dv.Elem().Kind() == reflect.Struct && scanKindOf(dv.Elem().Type()) == scanDefault {
+		var cols []string
+		if cols, err = rows.Columns(); err != nil {
+			return err
+		}
+		var si *structInfo
+		if si, err = getStructInfo(dv.Elem().Type(), mapper); err != nil {
+			return err
+		}
+		plan = si.scanPlan(cols)
+		v = plan.dests()
+	}
+
+	for rows.Next() {
+		resetDest(dv)
+		if plan != nil {
+			err = setStructValue(rows, dv, plan, v)
+		} else {
+			err = readRow(rows, dest, mapper)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = fn(); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// resetDest set values of dest to zero, pointers and types of map and slice elements are kept
+func resetDest(dv reflect.Value) {
+	switch dv.Kind() {
+	case reflect.Ptr:
+		if e := dv.Elem(); e.CanSet() && e.Kind() != reflect.Ptr {
+			e.Set(reflect.Zero(e.Type()))
+		}
+	case reflect.Map:
+		keys := dv.MapKeys()
+		for i := 0; i < len(keys); i++ {
+			dv.SetMapIndex(keys[i], zeroElem(dv.MapIndex(keys[i])))
+		}
+	case reflect.Slice:
+		for i := 0; i < dv.Len(); i++ {
+			dv.Index(i).Set(zeroElem(dv.Index(i)))
+		}
+	}
+}
+
+// zeroElem return zero value of map or slice elem, value that pointer elem points to is set to zero,
+// interface elem is zero value of its dynamic type
+func zeroElem(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		}
+		return v
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return zeroElem(v.Elem())
+	}
+	return reflect.Zero(v.Type())
+}
+
 // readInt64 copy value from rows to dest.
 func readInt64(rows *sql.Rows, dest interface{}) (err error) {
 	var v sql.NullInt64
@@ -1088,8 +1215,86 @@ func inDirect(v interface{}) interface{} {
 	}
 }
 
+// readValue copy value of single column from rows to dv, dv should be settable
+func readValue(rows *sql.Rows, dv reflect.Value, kind scanKind) error {
+	v := newScanDest(kind)
+	if err := rows.Scan(v); err != nil {
+		return err
+	}
+	return setScanValue(dv, kind, v)
+}
+
+// newScanDest return destination to scan column value of time, []byte or sql.Scanner
+func newScanDest(kind scanKind) interface{} {
+	switch kind {
+	case scanTime:
+		return &sql.NullTime{}
+	case scanBytes:
+		var b []byte
+		return &b
+	}
+	var tv interface{}
+	return &tv
+}
+
+// setScanValue set scanned value v to fv, NULL leaves fv unchanged except that sql.Scanner scans NULL itself.
+// pointer fv is allocated only if value isn't NULL
+func setScanValue(fv reflect.Value, kind scanKind, v interface{}) error {
+	if !fv.CanSet() {
+		return nil
+	}
+
+	switch kind {
+	case scanTime:
+		if x, _ := v.(*sql.NullTime); x.Valid {
+			if fv.Kind() == reflect.Ptr {
+				fv = newPtrValue(fv)
+			}
+			fv.Set(reflect.ValueOf(x.Time))
+		}
+	case scanBytes:
+		if b := *(v.(*[]byte)); b != nil {
+			if fv.Kind() == reflect.Ptr {
+				fv = newPtrValue(fv)
+			}
+			fv.Set(reflect.ValueOf(b).Convert(fv.Type()))
+		}
+	case scanScanner:
+		src := *(v.(*interface{}))
+		if fv.Kind() == reflect.Ptr {
+			if src == nil {
+				return nil
+			}
+			fv = newPtrValue(fv)
+		}
+		return fv.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	return nil
+}
+
+// isNullScan return true if scanned value v is NULL
+func isNullScan(v interface{}) bool {
+	switch x := v.(type) {
+	case *sql.NullBool:
+		return !x.Valid
+	case *sql.NullInt64:
+		return !x.Valid
+	case *sql.NullFloat64:
+		return !x.Valid
+	case *sql.NullString:
+		return !x.Valid
+	case *sql.NullTime:
+		return !x.Valid
+	case *[]byte:
+		return *x == nil
+	case *interface{}:
+		return *x == nil
+	}
+	return false
+}
+
 // readStruct copy value from rows to dest, dest should be potiner to a struct
-func readStruct(rows *sql.Rows, dest interface{}) error {
+func readStruct(rows *sql.Rows, dest interface{}, mapper *NameMapper) error {
 	if dest == nil {
 		return errors.New("dest is nil")
 	}
@@ -1097,7 +1302,7 @@ func readStruct(rows *sql.Rows, dest interface{}) error {
 	dv := reflect.ValueOf(dest)
 	dv = underlying(dv)
 	dt := dv.Type()
-	si, err := getStructInfo(dt)
+	si, err := getStructInfo(dt, mapper)
 	if err != nil {
 		return err
 	}
@@ -1107,47 +1312,127 @@ func readStruct(rows *sql.Rows, dest interface{}) error {
 		return err
 	}
 
+	plan := si.scanPlan(cols)
+	return setStructValue(rows, dv, plan, plan.dests())
+}
+
+// maxScanPlans is max number of cached scan plans of a struct type
+const maxScanPlans = 64
+
+// scanPlan is precomputed scan from columns to struct fields, it's created once per struct type and columns
+type scanPlan struct {
+	// fields is field of each column, nil if column is ignored
+	fields []*fieldInfo
+
+	// reuse is true if scan destination of column can be reused across rows
+	reuse []bool
+}
+
+// scanPlan return cached *scanPlan of columns
+func (si *structInfo) scanPlan(cols []string) *scanPlan {
+	key := strings.Join(cols, "\x00")
+
+	si.planLock.RLock()
+	plan, ok := si.plans[key]
+	si.planLock.RUnlock()
+	if ok {
+		return plan
+	}
+
 	fields := colsFields(cols, si)
-	return setStructValue(rows, dv, fields)
+	plan = &scanPlan{
+		fields: fields,
+		reuse:  make([]bool, len(fields)),
+	}
+	for i := 0; i < len(fields); i++ {
+		plan.reuse[i] = reusableScanDest(fields[i])
+	}
+
+	si.planLock.Lock()
+	defer si.planLock.Unlock()
+	if si.plans == nil {
+		si.plans = make(map[string]*scanPlan)
+	}
+	if len(si.plans) < maxScanPlans {
+		si.plans[key] = plan
+	}
+	return plan
+}
+
+// dests return scan destinations, reusable destinations are allocated, others are allocated by each scan
+func (plan *scanPlan) dests() []interface{} {
+	v := make([]interface{}, len(plan.fields))
+	for i := 0; i < len(plan.fields); i++ {
+		if plan.reuse[i] {
+			v[i] = newFieldScanDest(plan.fields[i])
+		}
+	}
+	return v
+}
+
+// reusableScanDest return true if scanned value is copied to field, so scan destination can be reused
+func reusableScanDest(fi *fieldInfo) bool {
+	if fi == nil || fi.scan != scanDefault {
+		return true
+	}
+
+	switch fi.uKind {
+	case reflect.Interface, reflect.Slice:
+		return false
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.Invalid, reflect.Chan, reflect.Func, reflect.Map, reflect.Ptr, reflect.Struct, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+// newFieldScanDest return scan destination of field, fi is nil if column is ignored
+func newFieldScanDest(fi *fieldInfo) interface{} {
+	if fi == nil {
+		var tv interface{}
+		return &tv
+	}
+	if fi.scan != scanDefault {
+		return newScanDest(fi.scan)
+	}
+
+	switch fi.uKind {
+	case reflect.Bool:
+		return &sql.NullBool{}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &sql.NullInt64{}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &sql.NullInt64{}
+	case reflect.Float32, reflect.Float64:
+		return &sql.NullFloat64{}
+	case reflect.String:
+		return &sql.NullString{}
+	case reflect.Interface:
+		var tv interface{}
+		return &tv
+	case reflect.Invalid, reflect.Chan, reflect.Func, reflect.Map, reflect.Ptr, reflect.Struct, reflect.UnsafePointer:
+		// ingore
+		var tv interface{}
+		return &tv
+	case reflect.Slice:
+		var tv interface{} = reflect.MakeSlice(fi.fType.Elem(), 0, 0).Interface()
+		return &tv
+	}
+	return reflect.New(fi.fType).Interface()
 }
 
-func setStructValue(rows *sql.Rows, dv reflect.Value, fields []*fieldInfo) error {
+// setStructValue scan current row to dv by plan, v is scan destinations returned by plan.dests
+func setStructValue(rows *sql.Rows, dv reflect.Value, plan *scanPlan, v []interface{}) error {
 	dv = underlying(dv)
 
+	fields := plan.fields
 	l := len(fields)
-	v := make([]interface{}, l)
-
 	for i := 0; i < l; i++ {
-		fi := fields[i]
-		if fi == nil {
-			var tv interface{}
-			v[i] = &tv
-			continue
-		}
-
-		switch fi.uKind {
-		case reflect.Bool:
-			v[i] = &sql.NullBool{}
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			v[i] = &sql.NullInt64{}
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			v[i] = &sql.NullInt64{}
-		case reflect.Float32, reflect.Float64:
-			v[i] = &sql.NullFloat64{}
-		case reflect.String:
-			v[i] = &sql.NullString{}
-		case reflect.Interface:
-			var tv interface{}
-			v[i] = &tv
-		case reflect.Invalid, reflect.Chan, reflect.Func, reflect.Map, reflect.Ptr, reflect.Struct, reflect.UnsafePointer:
-			// ingore
-			var tv interface{}
-			v[i] = &tv
-		case reflect.Slice:
-			var tv interface{} = reflect.MakeSlice(fi.fType.Elem(), 0, 0).Interface()
-			v[i] = &tv
-		default:
-			v[i] = reflect.New(fi.fType).Interface()
+		if !plan.reuse[i] {
+			v[i] = newFieldScanDest(fields[i])
 		}
 	}
 
@@ -1160,7 +1445,17 @@ func setStructValue(rows *sql.Rows, dv reflect.Value, fields []*fieldInfo) error
 		if fi == nil {
 			continue
 		}
-		fv := dv.Field(fi.index)
+		// pointer to nested struct is allocated only if value isn't NULL
+		fv, ok := fieldByIndex(dv, fi.index, !isNullScan(v[i]))
+		if !ok {
+			continue
+		}
+		if fi.scan != scanDefault {
+			if err := setScanValue(fv, fi.scan, v[i]); err != nil {
+				return fmt.Errorf("scan column %s to field %s error: %v", fi.colName, fi.fName, err)
+			}
+			continue
+		}
 
 		switch fi.uKind {
 		case reflect.Bool:
@@ -1228,8 +1523,15 @@ func setStructValue(rows *sql.Rows, dv reflect.Value, fields []*fieldInfo) error
 	return nil
 }
 
-// ReadRow scan current row value to dest. dest can be *T, []T, map[string]T
+// ReadRow scan current row value to dest. dest can be *T, []T, map[string]T,
+// *time.Time, *[]byte and sql.Scanner are scanned from single column, NULL leaves time and []byte unchanged.
+// columns are mapped to struct fields by DefaultNameMapper
 func ReadRow(rows *sql.Rows, dest interface{}) error {
+	return readRow(rows, dest, nil)
+}
+
+// readRow is ReadRow which map columns to struct fields by mapper
+func readRow(rows *sql.Rows, dest interface{}, mapper *NameMapper) error {
 	if rows == nil {
 		return errors.New("rows is nil.")
 	}
@@ -1255,10 +1557,15 @@ func ReadRow(rows *sql.Rows, dest interface{}) error {
 	}
 
 	rv := reflect.ValueOf(dest)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if kind := scanKindOf(rv.Type().Elem()); kind != scanDefault {
+			return readValue(rows, rv.Elem(), kind)
+		}
+	}
 	rv = underlying(rv)
 
 	if rv.Kind() == reflect.Struct {
-		return readStruct(rows, dest)
+		return readStruct(rows, dest, mapper)
 	}
 
 	//struct
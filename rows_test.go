@@ -2,10 +2,13 @@ package kdb
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"reflect"
 	"testing"
+	"time"
 )
 
 /*
@@ -920,3 +923,281 @@ func BenchmarkReadStruct(b *testing.B) {
 
 	b.Log("len(dest)", len(dest))
 }
+
+func BenchmarkReadStructFake(b *testing.B) {
+	db, source := newFakeDB(b, "fake")
+	defer db.Close()
+
+	values := make([][]driver.Value, 1000)
+	for i := 0; i < len(values); i++ {
+		values[i] = []driver.Value{int64(i), true, int64(i * 10), 3.14, "string"}
+	}
+	fakeResult(source, "tbench", []string{"id", "cbool", "cint", "cfloat", "cstring"}, values...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("select * from tbench")
+		if err != nil {
+			b.Fatal("Query error", err)
+		}
+
+		var dest []TypeInfo
+		if err = Read(rows, &dest); err != nil || len(dest) != len(values) {
+			b.Fatal("Read error", err, len(dest))
+		}
+		rows.Close()
+	}
+}
+
+// fakeMoney is a sql.Scanner and driver.Valuer, NULL is scanned to -1
+type fakeMoney struct {
+	cents int64
+}
+
+func (m *fakeMoney) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		m.cents = v
+	case nil:
+		m.cents = -1
+	default:
+		return fmt.Errorf("can not scan %T to fakeMoney", src)
+	}
+	return nil
+}
+
+func (m fakeMoney) Value() (driver.Value, error) {
+	return m.cents, nil
+}
+
+type tScanTypes struct {
+	Id      int
+	Created time.Time
+	Updated *time.Time
+	Data    []byte
+	DataPtr *[]byte
+	Text    string
+	Name    sql.NullString
+	Nick    *sql.NullString
+	Money   fakeMoney
+	Bonus   *fakeMoney
+}
+
+func TestReadTypes(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	cols := []string{"id", "created", "updated", "data", "dataptr", "text", "name", "nick", "money", "bonus"}
+	fakeResult(source, "tscan", cols,
+		[]driver.Value{int64(1), created, updated, []byte("ab"), []byte("cd"), []byte("text"), "n", []byte("k"), int64(100), int64(5)},
+		[]driver.Value{int64(2), nil, nil, nil, nil, nil, nil, nil, nil, nil})
+
+	rows, err := db.Query("select * from tscan")
+	if err != nil {
+		t.Fatal("query error", err)
+	}
+	var data []tScanTypes
+	if err = Read(rows, &data); err != nil {
+		t.Fatal("Read struct error", err)
+	}
+	rows.Close()
+	if len(data) != 2 {
+		t.Fatal("Read struct rows error", data)
+	}
+
+	a := data[0]
+	if !a.Created.Equal(created) || a.Updated == nil || !a.Updated.Equal(updated) ||
+		string(a.Data) != "ab" || a.DataPtr == nil || string(*a.DataPtr) != "cd" || a.Text != "text" ||
+		!a.Name.Valid || a.Name.String != "n" || a.Nick == nil || a.Nick.String != "k" ||
+		a.Money.cents != 100 || a.Bonus == nil || a.Bonus.cents != 5 {
+		t.Errorf("Read struct values error; actual=[%+v]", a)
+	}
+
+	b := data[1]
+	if !b.Created.IsZero() || b.Updated != nil || b.Data != nil || b.DataPtr != nil || b.Text != "" ||
+		b.Name.Valid || b.Nick != nil || b.Money.cents != -1 || b.Bonus != nil {
+		t.Errorf("Read struct NULL values error; actual=[%+v]", b)
+	}
+
+	fakeResult(source, "ttime", []string{"created"}, []driver.Value{created}, []driver.Value{nil})
+	rows, _ = db.Query("select created from ttime")
+	var times []*time.Time
+	if err = Read(rows, &times); err != nil || len(times) != 2 || !times[0].Equal(created) || times[1] != nil {
+		t.Error("Read *time.Time error", err, times)
+	}
+	rows.Close()
+
+	rows, _ = db.Query("select created from ttime")
+	var names []sql.NullString
+	if err = Read(rows, &names); err != nil || len(names) != 2 || !names[0].Valid || names[1].Valid {
+		t.Error("Read sql.Scanner error", err, names)
+	}
+	rows.Close()
+
+	fakeResult(source, "tbytes", []string{"data"}, []driver.Value{[]byte("ab")}, []driver.Value{nil})
+	rows, _ = db.Query("select data from tbytes")
+	var bytes [][]byte
+	if err = Read(rows, &bytes); err != nil || len(bytes) != 2 || string(bytes[0]) != "ab" || bytes[1] != nil {
+		t.Error("Read []byte error", err, bytes)
+	}
+	rows.Close()
+
+	rows, _ = db.Query("select created from ttime")
+	tm, money := updated, fakeMoney{}
+	for i := 0; rows.Next(); i++ {
+		if err = ReadRow(rows, &tm); err != nil || !tm.Equal(created) {
+			t.Error("ReadRow time error", err, tm)
+		}
+	}
+	rows.Close()
+
+	fakeResult(source, "tmoney", []string{"money"}, []driver.Value{nil})
+	rows, _ = db.Query("select money from tmoney")
+	for rows.Next() {
+		if err = ReadRow(rows, &money); err != nil || money.cents != -1 {
+			t.Error("ReadRow sql.Scanner error", err, money)
+		}
+	}
+	rows.Close()
+
+	fakeTable(source, "tvaluer", "", "money")
+	if _, err = db.Insert("tvaluer", Entity(struct{ Money fakeMoney }{fakeMoney{10}})); err != nil {
+		t.Error("Insert driver.Valuer error", err)
+	}
+	args := fakeArgs(source)
+	if last := args[len(args)-1]; len(last) != 1 || last[0] != int64(10) {
+		t.Errorf("Insert driver.Valuer arg error; want=[%v]; actual=[%v]", int64(10), last)
+	}
+}
+
+func TestReadNested(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	cols := []string{"id", "name", "created_at", "home_city", "home_zipcode", "work_city", "work_zipcode", "c_id"}
+	fakeResult(source, "tnested", cols,
+		[]driver.Value{int64(1), "a", "now", "x", "100", "y", nil, nil},
+		[]driver.Value{int64(2), "b", nil, nil, nil, nil, nil, int64(3)})
+
+	rows, err := db.Query("select * from tnested")
+	if err != nil {
+		t.Fatal("query error", err)
+	}
+	defer rows.Close()
+
+	var data []*tNestedEntity
+	if err = Read(rows, &data); err != nil || len(data) != 2 {
+		t.Fatal("Read nested struct error", err, data)
+	}
+
+	a, b := data[0], data[1]
+	if a.Id != 1 || a.CreatedAt != "now" || a.Home.City != "x" || a.Home.Zip != "100" ||
+		a.Work == nil || a.Work.City != "y" || a.Work.Zip != "" || a.Created != nil {
+		t.Errorf("Read nested struct values error; actual=[%+v]", a)
+	}
+	if b.Work != nil || b.Created == nil || b.Created.Id != 3 {
+		t.Errorf("Read nested struct pointer error; actual=[%+v]", b)
+	}
+}
+
+func TestReadStructPlan(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	fakeResult(source, "tplan_a", []string{"cint", "id"}, []driver.Value{int64(1), int64(2)})
+	fakeResult(source, "tplan_b", []string{"id", "cstring", "none"}, []driver.Value{int64(3), "s", "x"}, []driver.Value{int64(4), nil, nil})
+	fakeResult(source, "tplan_c", []string{"id", "cint"}, []driver.Value{int64(5), int64(6)}, []driver.Value{int64(7), "abc"})
+
+	var a, b []TypeInfo
+	rows, _ := db.Query("select * from tplan_a")
+	if err := Read(rows, &a); err != nil || len(a) != 1 || a[0].CInt != 1 || a[0].Id != 2 {
+		t.Error("Read struct by plan error", err, a)
+	}
+	rows.Close()
+
+	rows, _ = db.Query("select * from tplan_b")
+	if err := Read(rows, &b); err != nil || len(b) != 2 || b[0].Id != 3 || b[0].CString != "s" || b[1].Id != 4 || b[1].CString != "" {
+		t.Error("Read struct by plan of other columns error", err, b)
+	}
+	rows.Close()
+
+	rows, _ = db.Query("select * from tplan_c")
+	if err := Read(rows, &a); err == nil || len(a) != 2 || a[1].Id != 5 {
+		t.Error("Read struct should keep scanned rows when scan fails", err, a)
+	}
+	rows.Close()
+}
+
+func TestEach(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	cols := []string{"id", "cbool", "cint", "cfloat", "cstring"}
+	fakeResult(source, "teach", cols,
+		[]driver.Value{int64(1), true, int64(10), 1.5, "a"},
+		[]driver.Value{int64(2), nil, nil, nil, nil},
+		[]driver.Value{int64(3), false, int64(30), 3.5, "c"})
+
+	var v TypeInfo
+	var got []TypeInfo
+	rows, _ := db.Query("select * from teach")
+	err := Each(rows, &v, func() error {
+		got = append(got, v)
+		return nil
+	})
+	if err != nil || len(got) != 3 || got[0].CString != "a" || got[2].CInt != 30 {
+		t.Fatal("Each struct error", err, got)
+	}
+	if want := (TypeInfo{Id: 2}); got[1] != want {
+		t.Errorf("Each should reset dest before each row; want=[%v]; actual=[%v]", want, got[1])
+	}
+
+	m := map[string]interface{}{}
+	var ids []interface{}
+	rows, _ = db.Query("select * from teach")
+	err = Each(rows, m, func() error {
+		ids = append(ids, m["id"])
+		if len(ids) == 2 {
+			if m["cstring"] != "" {
+				t.Error("Each map should reset dest before each row", m)
+			}
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil || len(ids) != 2 {
+		t.Error("Each map with ErrStop error", err, ids)
+	}
+	if err = rows.Err(); err != nil || rows.Next() {
+		t.Error("Each should close rows", err)
+	}
+
+	s := make([]string, len(cols))
+	count := 0
+	rows, _ = db.Query("select * from teach")
+	err = Each(rows, s, func() error {
+		count++
+		if s[0] == "2" && s[4] != "" {
+			t.Error("Each slice should reset dest before each row", s)
+		}
+		return nil
+	})
+	if err != nil || count != 3 || s[4] != "c" {
+		t.Error("Each slice error", err, count, s)
+	}
+
+	stop := errors.New("stop")
+	rows, _ = db.Query("select * from teach")
+	if err = Each(rows, &v, func() error { return stop }); err != stop {
+		t.Error("Each should return error of fn", err)
+	}
+
+	rows, _ = db.Query("select * from teach")
+	if err = Each(rows, (*TypeInfo)(nil), func() error { return nil }); err == nil {
+		t.Error("Each with nil dest should return error")
+	}
+}
@@ -0,0 +1,508 @@
+package kdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// Tx is wrap of *sql.Tx, provide same methods as *DB
+type Tx struct {
+	db        *DB
+	innertx   *sql.Tx
+	savepoint int
+}
+
+// Begin starts a transaction
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginContext(context.Background(), nil)
+}
+
+// BeginContext starts a transaction with context and options, opts may be nil
+func (db *DB) BeginContext(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.innerdb.BeginTx(ctx, opts)
+	if LogLevel >= LogDebug {
+		logDebug("DB begin:", db.DSN, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{db: db, innertx: tx}, nil
+}
+
+// InTx executes fn in a transaction, commit if fn return nil, rollback if fn return error or panic
+func (db *DB) InTx(fn func(tx *Tx) error) error {
+	return db.InTxContext(context.Background(), fn)
+}
+
+// InTxContext is same as InTx, the transaction is started with context
+func (db *DB) InTxContext(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginContext(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	return runTx(tx, fn, tx.Commit, tx.Rollback)
+}
+
+// runTx call fn, then call commit or rollback according result of fn
+func runTx(tx *Tx, fn func(tx *Tx) error, commit, rollback func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr := rollback(); rerr != nil {
+				logError("Tx rollback error", rerr)
+			}
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rerr := rollback(); rerr != nil {
+			logError("Tx rollback error", rerr)
+		}
+		return err
+	}
+
+	return commit()
+}
+
+// DB return *DB that begin this transaction
+func (tx *Tx) DB() *DB {
+	return tx.db
+}
+
+// Tx return internal *sql.Tx
+func (tx *Tx) Tx() *sql.Tx {
+	return tx.innertx
+}
+
+// Commit commit the transaction
+func (tx *Tx) Commit() error {
+	err := tx.innertx.Commit()
+	if LogLevel >= LogDebug {
+		logDebug("Tx commit:", tx.db.DSN, err)
+	}
+	return err
+}
+
+// Rollback abort the transaction
+func (tx *Tx) Rollback() error {
+	err := tx.innertx.Rollback()
+	if LogLevel >= LogDebug {
+		logDebug("Tx rollback:", tx.db.DSN, err)
+	}
+	return err
+}
+
+// InTx executes fn in a nested transaction by savepoint, release savepoint if fn return nil,
+// rollback to savepoint if fn return error or panic
+func (tx *Tx) InTx(fn func(tx *Tx) error) error {
+	name, err := tx.Savepoint()
+	if err != nil {
+		return err
+	}
+
+	commit := func() error {
+		return tx.ReleaseSavepoint(name)
+	}
+	rollback := func() error {
+		return tx.RollbackTo(name)
+	}
+	return runTx(tx, fn, commit, rollback)
+}
+
+// Savepoint create a savepoint and return name of it
+func (tx *Tx) Savepoint() (string, error) {
+	name := "kdb_sp" + strconv.Itoa(tx.savepoint+1)
+	query, err := tx.savepointSql(_savepointCreate, name)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = tx.Exec(query); err != nil {
+		return "", err
+	}
+	tx.savepoint++
+	return name, nil
+}
+
+// ReleaseSavepoint release a savepoint
+func (tx *Tx) ReleaseSavepoint(name string) error {
+	query, err := tx.savepointSql(_savepointRelease, name)
+	if err != nil {
+		return err
+	}
+
+	// some database doesn't support release savepoint
+	if query != "" {
+		_, err = tx.Exec(query)
+	}
+	return err
+}
+
+// RollbackTo rollback to a savepoint
+func (tx *Tx) RollbackTo(name string) error {
+	query, err := tx.savepointSql(_savepointRollback, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query)
+	return err
+}
+
+const (
+	_savepointCreate   = 1
+	_savepointRelease  = 2
+	_savepointRollback = 3
+)
+
+func (tx *Tx) savepointSql(action int, name string) (string, error) {
+	dialect, err := tx.db.dialecter()
+	if err != nil {
+		return "", err
+	}
+
+	switch dialect.Name() {
+	case "mysql", "postgres", "sqlite":
+		switch action {
+		case _savepointCreate:
+			return "SAVEPOINT " + name, nil
+		case _savepointRelease:
+			return "RELEASE SAVEPOINT " + name, nil
+		case _savepointRollback:
+			return "ROLLBACK TO SAVEPOINT " + name, nil
+		}
+	case "oracle":
+		switch action {
+		case _savepointCreate:
+			return "SAVEPOINT " + name, nil
+		case _savepointRelease:
+			return "", nil
+		case _savepointRollback:
+			return "ROLLBACK TO SAVEPOINT " + name, nil
+		}
+	case "mssql":
+		switch action {
+		case _savepointCreate:
+			return "SAVE TRANSACTION " + name, nil
+		case _savepointRelease:
+			return "", nil
+		case _savepointRollback:
+			return "ROLLBACK TRANSACTION " + name, nil
+		}
+	}
+
+	return "", errors.New("driver doesn't support savepoint:" + dialect.Name())
+}
+
+// Query executes a query that returns *sql.Rows
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query that returns *sql.Rows
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := tx.innertx.QueryContext(ctx, query, args...)
+	if LogLevel >= LogDebug {
+		logDebug("Tx query:", query, args, err)
+	}
+
+	return rows, err
+}
+
+// Exec executes a query that return sql.Result
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query that return sql.Result
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := tx.innertx.ExecContext(ctx, query, args...)
+	if LogLevel >= LogDebug {
+		logDebug("Tx exec:", query, args, result, err)
+	}
+
+	return result, err
+}
+
+// QueryText query a sql text templete
+func (tx *Tx) QueryText(template string, args Getter) (*sql.Rows, error) {
+	return tx.QueryTextContext(context.Background(), template, args)
+}
+
+// QueryTextContext query a sql text templete
+func (tx *Tx) QueryTextContext(ctx context.Context, template string, args Getter) (*sql.Rows, error) {
+	text, err := tx.db.parseText(template, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.QueryExpContext(ctx, text)
+}
+
+// ExecText exec a sql text template
+func (tx *Tx) ExecText(query string, args Getter) (sql.Result, error) {
+	return tx.ExecTextContext(context.Background(), query, args)
+}
+
+// ExecTextContext exec a sql text template
+func (tx *Tx) ExecTextContext(ctx context.Context, query string, args Getter) (sql.Result, error) {
+	text, err := tx.db.parseText(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.ExecExpContext(ctx, text)
+}
+
+// QueryExp query a expression
+func (tx *Tx) QueryExp(exp Expression) (*sql.Rows, error) {
+	return tx.QueryExpContext(context.Background(), exp)
+}
+
+// QueryExpContext query a expression
+func (tx *Tx) QueryExpContext(ctx context.Context, exp Expression) (*sql.Rows, error) {
+	sql, args, err := tx.db.Compile(exp)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.QueryContext(ctx, sql, args...)
+}
+
+// ExecExp execute a expression
+func (tx *Tx) ExecExp(exp Expression) (sql.Result, error) {
+	return tx.ExecExpContext(context.Background(), exp)
+}
+
+// ExecExpContext execute a expression
+func (tx *Tx) ExecExpContext(ctx context.Context, exp Expression) (sql.Result, error) {
+	sql, args, err := tx.db.Compile(exp)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.ExecContext(ctx, sql, args...)
+}
+
+// ExecReturning execute insert, update or delete with Returning columns, then read returned rows to dest by Read
+func (tx *Tx) ExecReturning(exp Expression, dest interface{}) error {
+	return tx.ExecReturningContext(context.Background(), exp, dest)
+}
+
+// ExecReturningContext execute insert, update or delete with Returning columns, then read returned rows to dest by Read.
+// oracle returns values of one row by RETURNING INTO, dest should be pointer to struct, map[string]interface{}, value of single column or slice of them
+func (tx *Tx) ExecReturningContext(ctx context.Context, exp Expression, dest interface{}) error {
+	o, oracle, err := tx.db.checkReturning(exp)
+	if err != nil {
+		return err
+	}
+	if oracle {
+		return tx.db.execOracleReturning(ctx, tx, exp, o, dest)
+	}
+
+	rows, err := tx.QueryExpContext(ctx, exp)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return read(rows, dest, tx.db.nameMapper())
+}
+
+// Read is Read which map columns to struct fields by NameMapper of db
+func (tx *Tx) Read(rows *sql.Rows, dest interface{}) error {
+	return read(rows, dest, tx.db.nameMapper())
+}
+
+// Each is Each which map columns to struct fields by NameMapper of db
+func (tx *Tx) Each(rows *sql.Rows, dest interface{}, fn func() error) error {
+	return each(rows, dest, fn, tx.db.nameMapper())
+}
+
+// QueryFunc query a store procedure
+func (tx *Tx) QueryFunc(name string, args Getter) (*sql.Rows, error) {
+	return tx.QueryFuncContext(context.Background(), name, args)
+}
+
+// QueryFuncContext query a store procedure
+func (tx *Tx) QueryFuncContext(ctx context.Context, name string, args Getter) (*sql.Rows, error) {
+	sp, err := tx.db.buildProcedure(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.QueryExpContext(ctx, sp)
+}
+
+// ExecFunc exec a store procedure
+func (tx *Tx) ExecFunc(name string, args Getter) (sql.Result, error) {
+	return tx.ExecFuncContext(context.Background(), name, args)
+}
+
+// ExecFuncContext exec a store procedure
+func (tx *Tx) ExecFuncContext(ctx context.Context, name string, args Getter) (sql.Result, error) {
+	sp, err := tx.db.buildProcedure(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.ExecExpContext(ctx, sp)
+}
+
+// Delete delete table by conditions, conditions format is column, operator, value, ...
+func (tx *Tx) Delete(table string, conditions ...interface{}) (sql.Result, error) {
+	return tx.DeleteContext(context.Background(), table, conditions...)
+}
+
+// DeleteContext delete table by conditions, conditions format is column, operator, value, ...
+func (tx *Tx) DeleteContext(ctx context.Context, table string, conditions ...interface{}) (sql.Result, error) {
+	d, err := tx.db.buildDelete(table, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.ExecExpContext(ctx, d)
+}
+
+// DeleteByCol delete table with condition column = value
+func (tx *Tx) DeleteByCol(table string, column string, value interface{}) (sql.Result, error) {
+	return tx.DeleteByColContext(context.Background(), table, column, value)
+}
+
+// DeleteByColContext delete table with condition column = value
+func (tx *Tx) DeleteByColContext(ctx context.Context, table string, column string, value interface{}) (sql.Result, error) {
+	return tx.ExecExpContext(ctx, tx.db.buildDeleteByCol(table, column, value))
+}
+
+// SelectAll return table.*  by conditions, conditions format is column, operator, value, ...
+func (tx *Tx) SelectAll(table string, conditions ...interface{}) (*sql.Rows, error) {
+	return tx.SelectAllContext(context.Background(), table, conditions...)
+}
+
+// SelectAllContext return table.*  by conditions, conditions format is column, operator, value, ...
+func (tx *Tx) SelectAllContext(ctx context.Context, table string, conditions ...interface{}) (*sql.Rows, error) {
+	q, err := tx.db.buildSelectAll(table, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return tx.QueryExpContext(ctx, q)
+}
+
+// SelectExists return true if exists conditions
+func (tx *Tx) SelectExists(table string, conditions ...interface{}) (bool, error) {
+	return tx.SelectExistsContext(context.Background(), table, conditions...)
+}
+
+// SelectExistsContext return true if exists conditions
+func (tx *Tx) SelectExistsContext(ctx context.Context, table string, conditions ...interface{}) (bool, error) {
+	count, err := tx.SelectCountContext(ctx, table, conditions...)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SelectCount query select count(*) from [table] where conditions...
+func (tx *Tx) SelectCount(table string, conditions ...interface{}) (count int64, err error) {
+	return tx.SelectCountContext(context.Background(), table, conditions...)
+}
+
+// SelectCountContext query select count(*) from [table] where conditions...
+func (tx *Tx) SelectCountContext(ctx context.Context, table string, conditions ...interface{}) (count int64, err error) {
+	var q *Query
+	if q, err = tx.db.buildSelectCount(table, conditions); err != nil {
+		return
+	}
+
+	var rows *sql.Rows
+	if rows, err = tx.QueryExpContext(ctx, q); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	err = scanScalar(rows, &count)
+	return
+}
+
+// Update update a table to data with conditions...
+func (tx *Tx) Update(table string, data Getter, conditions ...interface{}) (sql.Result, error) {
+	return tx.UpdateContext(context.Background(), table, data, conditions...)
+}
+
+// UpdateContext update a table to data with conditions...
+func (tx *Tx) UpdateContext(ctx context.Context, table string, data Getter, conditions ...interface{}) (sql.Result, error) {
+	u, err := tx.db.buildUpdate(ctx, table, data, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return tx.ExecExpContext(ctx, u)
+}
+
+// UpdateColumn exec table.column = value where conditions...
+func (tx *Tx) UpdateColumn(table string, column string, value interface{}, conditions ...interface{}) (int64, error) {
+	return tx.UpdateColumnContext(context.Background(), table, column, value, conditions...)
+}
+
+// UpdateColumnContext exec table.column = value where conditions...
+func (tx *Tx) UpdateColumnContext(ctx context.Context, table string, column string, value interface{}, conditions ...interface{}) (int64, error) {
+	return rowsAffectedErr(tx.ExecExpContext(ctx, tx.db.buildUpdateColumn(table, column, value, conditions)))
+}
+
+// Insert insert data to table
+func (tx *Tx) Insert(table string, data Getter) (sql.Result, error) {
+	return tx.InsertContext(context.Background(), table, data)
+}
+
+// InsertContext insert data to table
+func (tx *Tx) InsertContext(ctx context.Context, table string, data Getter) (sql.Result, error) {
+	insert, err := tx.db.buildInsert(ctx, table, data)
+	if err != nil {
+		return nil, err
+	}
+	return tx.ExecExpContext(ctx, insert)
+}
+
+// InsertMany insert rows of data to table, return total rows affected
+func (tx *Tx) InsertMany(table string, data []Getter) (int64, error) {
+	return tx.InsertManyContext(context.Background(), table, data)
+}
+
+// InsertManyContext insert rows of data to table, return total rows affected
+func (tx *Tx) InsertManyContext(ctx context.Context, table string, data []Getter) (int64, error) {
+	inserts, err := tx.db.buildInsertMany(ctx, table, data)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for i := 0; i < len(inserts); i++ {
+		n, err := rowsAffectedErr(tx.ExecExpContext(ctx, inserts[i]))
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// Upsert insert data to table, or update row if values of keys exist; keys are primary key columns if not provided
+func (tx *Tx) Upsert(table string, data Getter, keys ...string) (sql.Result, error) {
+	return tx.UpsertContext(context.Background(), table, data, keys...)
+}
+
+// UpsertContext insert data to table, or update row if values of keys exist; keys are primary key columns if not provided
+func (tx *Tx) UpsertContext(ctx context.Context, table string, data Getter, keys ...string) (sql.Result, error) {
+	u, err := tx.db.buildUpsert(ctx, table, data, keys)
+	if err != nil {
+		return nil, err
+	}
+	return tx.ExecExpContext(ctx, u)
+}
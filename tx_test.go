@@ -0,0 +1,153 @@
+package kdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newFakeDB(t testing.TB, driver string) (*DB, string) {
+	source := driver + ":" + t.Name()
+	fakeReset(source)
+	RegisterDSN(t.Name(), driver, source)
+	return NewDB(t.Name()), source
+}
+
+func assertLog(t *testing.T, source string, want ...string) {
+	log := fakeLog(source)
+	if strings.Join(log, "\n") != strings.Join(want, "\n") {
+		t.Errorf("statements error; want=[%v]; actual=[%v]", want, log)
+	}
+}
+
+func TestInTxCommit(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	err := db.InTx(func(tx *Tx) error {
+		_, err := tx.Exec("update ttable set cint = 1")
+		return err
+	})
+	if err != nil {
+		t.Error("InTx error", err)
+	}
+
+	assertLog(t, source, "BEGIN", "update ttable set cint = 1", "COMMIT")
+}
+
+func TestInTxRollback(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	want := errors.New("abort")
+	err := db.InTx(func(tx *Tx) error {
+		if _, err := tx.Exec("update ttable set cint = 1"); err != nil {
+			return err
+		}
+		return want
+	})
+	if err != want {
+		t.Errorf("InTx error; want=[%v]; actual=[%v]", want, err)
+	}
+
+	assertLog(t, source, "BEGIN", "update ttable set cint = 1", "ROLLBACK")
+}
+
+func TestInTxPanic(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("InTx panic; want=[%v]; actual=[%v]", "boom", r)
+			}
+		}()
+
+		db.InTx(func(tx *Tx) error {
+			panic("boom")
+		})
+	}()
+
+	assertLog(t, source, "BEGIN", "ROLLBACK")
+}
+
+func TestInTxNested(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	err := db.InTx(func(tx *Tx) error {
+		tx.InTx(func(tx *Tx) error {
+			_, err := tx.Exec("delete from ttable")
+			return err
+		})
+
+		return tx.InTx(func(tx *Tx) error {
+			tx.Exec("update ttable set cint = 1")
+			return errors.New("abort nested")
+		})
+	})
+	if err == nil {
+		t.Error("InTx should return error of nested transaction")
+	}
+
+	assertLog(t, source,
+		"BEGIN",
+		"SAVEPOINT kdb_sp1",
+		"delete from ttable",
+		"RELEASE SAVEPOINT kdb_sp1",
+		"SAVEPOINT kdb_sp2",
+		"update ttable set cint = 1",
+		"ROLLBACK TO SAVEPOINT kdb_sp2",
+		"ROLLBACK",
+	)
+}
+
+func TestInTxNestedMssql(t *testing.T) {
+	db, source := newFakeDB(t, "fakemssql")
+	defer db.Close()
+
+	db.InTx(func(tx *Tx) error {
+		return tx.InTx(func(tx *Tx) error {
+			return errors.New("abort nested")
+		})
+	})
+
+	assertLog(t, source,
+		"BEGIN",
+		"SAVE TRANSACTION kdb_sp1",
+		"ROLLBACK TRANSACTION kdb_sp1",
+		"ROLLBACK",
+	)
+}
+
+func TestTxExp(t *testing.T) {
+	db, source := newFakeDB(t, "fake")
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin error", err)
+	}
+
+	if _, err = tx.DeleteByCol("ttable", "cint", 42); err != nil {
+		t.Error("DeleteByCol error", err)
+	}
+	if _, err = tx.UpdateColumn("ttable", "cstring", "a", "cint", Equals, 42); err != nil {
+		t.Error("UpdateColumn error", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Error("Commit error", err)
+	}
+
+	log := fakeLog(source)
+	if len(log) != 4 || log[0] != "BEGIN" || log[3] != "COMMIT" {
+		t.Errorf("Tx statements error; actual=[%v]", log)
+	}
+	if removeSpace(log[1]) != removeSpace("DELETE FROM ttable WHERE cint = $1;") {
+		t.Errorf("Tx delete error; actual=[%v]", log[1])
+	}
+	if removeSpace(log[2]) != removeSpace("UPDATE ttable SET cstring=$1 WHERE cint = $2;") {
+		t.Errorf("Tx update error; actual=[%v]", log[2])
+	}
+}
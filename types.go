@@ -2,11 +2,13 @@ package kdb
 
 import (
 	"bytes"
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 // tagStart is prefix of kdb tag
@@ -79,24 +81,26 @@ func parseTag(tag string) *tagOptions {
 // structInfo is a wrap of kdb struct information
 type structInfo struct {
 	sType  reflect.Type
+	mapper *NameMapper
 	fields []*fieldInfo
+
+	// names is fields by lower case colName
+	names map[string]*fieldInfo
+
+	// plans is cached scan plans by columns
+	plans    map[string]*scanPlan
+	planLock sync.RWMutex
 }
 
-// FieldByColName return field which colName equal name
+// FieldByColName return field which colName equal name case-insensitively
 func (si *structInfo) FieldByColName(name string) (*fieldInfo, bool) {
-	l := len(si.fields)
-	for i := 0; i < l; i++ {
-		f := si.fields[i]
-		if strings.EqualFold(f.colName, name) {
-			return f, true
-		}
-	}
-	return nil, false
+	f, ok := si.names[strings.ToLower(name)]
+	return f, ok
 }
 
 // fieldInfo is kdb struct field inforamtion
 type fieldInfo struct {
-	index   int
+	index   []int
 	fName   string
 	fType   reflect.Type
 	fKind   reflect.Kind
@@ -105,10 +109,53 @@ type fieldInfo struct {
 	uKind   reflect.Kind
 	//uType   reflect.Type
 
+	// scan is how column value is scanned to field
+	scan scanKind
+}
+
+// scanKind is how a column value is scanned to a field or value
+type scanKind int
+
+const (
+	// scanDefault scan by kind of value
+	scanDefault scanKind = iota
+
+	// scanScanner scan by sql.Scanner of value
+	scanScanner
+
+	// scanTime scan to time.Time
+	scanTime
+
+	// scanBytes scan to []byte
+	scanBytes
+)
+
+var (
+	_scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	_timeType    = reflect.TypeOf(time.Time{})
+)
+
+// scanKindOf return scanKind of type t or type *t points to
+func scanKindOf(t reflect.Type) scanKind {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case reflect.PtrTo(t).Implements(_scannerType):
+		return scanScanner
+	case t == _timeType:
+		return scanTime
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return scanBytes
+	}
+	return scanDefault
 }
 
-// parseStruct parse *structInfo of a struct, 
-func parseStruct(structType reflect.Type) (*structInfo, error) {
+// parseStruct parse *structInfo of a struct, fields of anonymous embedded structs are flattened,
+// fields of nested struct with tag option prefix are mapped to columns prefix + column name.
+// column name of field without tag option name is mapped by mapper, DefaultNameMapper if mapper is nil
+func parseStruct(structType reflect.Type, mapper *NameMapper) (*structInfo, error) {
 
 	if structType == nil {
 		return nil, errors.New("structType is nil")
@@ -119,23 +166,52 @@ func parseStruct(structType reflect.Type) (*structInfo, error) {
 		return nil, fmt.Errorf("%v is not a struct", structType)
 	}
 
+	if mapper == nil {
+		mapper = DefaultNameMapper
+	}
+
 	si := &structInfo{}
 	si.sType = structType
+	si.mapper = mapper
+	si.fields = make([]*fieldInfo, 0, structType.NumField())
+	si.parseFields(structType, nil, "", "", []reflect.Type{structType})
+	si.removeShadowed()
+
+	si.names = make(map[string]*fieldInfo, len(si.fields))
+	for i := 0; i < len(si.fields); i++ {
+		si.names[strings.ToLower(si.fields[i].colName)] = si.fields[i]
+	}
+
+	return si, nil
+}
 
-	count := structType.NumField()
-	si.fields = make([]*fieldInfo, 0, count)
+// parseFields append fields of struct type t, index is index path of t, path is types from root to t
+func (si *structInfo) parseFields(t reflect.Type, index []int, prefix string, fieldPrefix string, path []reflect.Type) {
+	count := t.NumField()
 	for i := 0; i < count; i++ {
-		f := structType.Field(i)
+		f := t.Field(i)
+		tag := parseTag(string(f.Tag))
+		fIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+
+		// unexported embedded struct is allowed, its exported fields are promoted
+		if f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		if nested, ok := nestedStruct(f, tag, path); ok {
+			p, _ := tag.Option("prefix")
+			si.parseFields(nested, fIndex, prefix+p, fieldPrefix+f.Name+".", append(path, nested))
+			continue
+		}
 		if f.PkgPath != "" {
 			continue
 		}
-		tag := parseTag(string(f.Tag))
 
 		var colName string
 		if name, _ := tag.Option("name"); name != "" {
 			colName = name
 		} else {
-			colName = f.Name
+			colName = si.mapper.ColumnName(f.Name)
 		}
 
 		vKind := f.Type.Kind()
@@ -144,29 +220,103 @@ func parseStruct(structType reflect.Type) (*structInfo, error) {
 		}
 
 		si.fields = append(si.fields, &fieldInfo{
-			index:   i,
-			fName:   f.Name,
+			index:   fIndex,
+			fName:   fieldPrefix + f.Name,
 			fType:   f.Type,
 			fKind:   f.Type.Kind(),
 			tag:     tag,
-			colName: colName,
+			colName: prefix + colName,
 			uKind:   vKind,
+			scan:    scanKindOf(f.Type),
 		})
 	}
+}
 
-	return si, nil
+// nestedStruct return struct type if field is anonymous embedded struct or has tag option prefix,
+// struct or pointer to struct of time or sql.Scanner isn't nested, nor is struct of recursive type
+func nestedStruct(f reflect.StructField, tag *tagOptions, path []reflect.Type) (reflect.Type, bool) {
+	if !f.Anonymous && !tag.Contains("prefix") {
+		return nil, false
+	}
+	if f.Anonymous && tag.Contains("name") {
+		return nil, false
+	}
+
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || scanKindOf(t) != scanDefault {
+		return nil, false
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] == t {
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+// removeShadowed remove fields shadowed by field of same column name at shallower depth, like go embedding
+func (si *structInfo) removeShadowed() {
+	fields := make([]*fieldInfo, 0, len(si.fields))
+	for i := 0; i < len(si.fields); i++ {
+		f := si.fields[i]
+		shadowed := false
+		for j := 0; j < len(si.fields); j++ {
+			g := si.fields[j]
+			if i != j && strings.EqualFold(f.colName, g.colName) &&
+				(len(g.index) < len(f.index) || (len(g.index) == len(f.index) && j < i)) {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			fields = append(fields, f)
+		}
+	}
+	si.fields = fields
+}
+
+// fieldByIndex return nested field of v by index path, nil pointer to nested struct is allocated if alloc is true,
+// return false if pointer is nil and isn't allocated
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i := 0; i < len(index); i++ {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index[i])
+	}
+	return v, true
 }
 
-// siCache is cache of *structInfo, key is kpgpath_name
-var siCache map[string]*structInfo = make(map[string]*structInfo)
+// siKey is key of siCache
+type siKey struct {
+	sType  reflect.Type
+	mapper *NameMapper
+}
+
+// siCache is cache of *structInfo
+var siCache map[siKey]*structInfo = make(map[siKey]*structInfo)
 var siCacheLock sync.RWMutex
 
-func getStructInfo(structType reflect.Type) (*structInfo, error) {
+// getStructInfo return cached *structInfo of struct type mapped by mapper, DefaultNameMapper if mapper is nil
+func getStructInfo(structType reflect.Type, mapper *NameMapper) (*structInfo, error) {
 	if structType == nil {
 		return nil, errors.New("structType is nil")
 	}
+	if mapper == nil {
+		mapper = DefaultNameMapper
+	}
 
-	key := structType.PkgPath() + "_" + structType.Name()
+	structType = underlyingType(structType)
+	key := siKey{sType: structType, mapper: mapper}
 	siCacheLock.RLock()
 	si, ok := siCache[key]
 	siCacheLock.RUnlock()
@@ -177,18 +327,22 @@ func getStructInfo(structType reflect.Type) (*structInfo, error) {
 	}
 
 	var err error
-	if si, err = parseStruct(structType); err != nil {
+	if si, err = parseStruct(structType, mapper); err != nil {
 		return nil, err
 	}
-	setStructInfoCache(key, si)
-	return si, nil
+	return setStructInfoCache(key, si), nil
 }
 
-func setStructInfoCache(key string, si *structInfo) {
+// setStructInfoCache cache si if key isn't cached, return cached *structInfo
+func setStructInfoCache(key siKey, si *structInfo) *structInfo {
 	//fmt.Println("set cache", key, si.sType)
 	siCacheLock.Lock()
 	defer siCacheLock.Unlock()
+	if cached, ok := siCache[key]; ok {
+		return cached
+	}
 	siCache[key] = si
+	return si
 }
 
 func underlying(v reflect.Value) reflect.Value {
@@ -227,17 +381,17 @@ func setValue(t reflect.Type) reflect.Type {
 func newPtrValue(v reflect.Value) reflect.Value {
 	if v.IsNil() && v.CanSet() {
 		v.Set(reflect.New(v.Type().Elem()))
-		return v.Elem()
 	}
-	return v
+	return v.Elem()
 }
 
 // GEntity wrap a struct, provide interface Getter and Iterater
 type GEntity struct {
 	Data    interface{}
 	v       reflect.Value
-	fields  []*fieldInfo
+	si      *structInfo
 	filters []string
+	mapper  *NameMapper
 }
 
 // String
@@ -247,20 +401,12 @@ func (e GEntity) String() string {
 
 // Get return field value by name
 func (e *GEntity) Get(name string) (interface{}, bool) {
-	l := len(e.fields)
-	var fi *fieldInfo
-
-	for i := 0; i < l; i++ {
-		if strings.EqualFold(e.fields[i].colName, name) {
-			fi = e.fields[i]
-			break
-		}
-	}
-	if fi == nil {
+	fi, ok := e.si.FieldByColName(name)
+	if !ok {
 		return nil, false
 	}
 	if e.filters != nil {
-		l = len(e.filters)
+		l := len(e.filters)
 		for i := 0; i < l; i++ {
 			if fi.tag.Contains(e.filters[i]) {
 				return nil, false
@@ -268,7 +414,10 @@ func (e *GEntity) Get(name string) (interface{}, bool) {
 		}
 	}
 
-	fv := e.v.Field(fi.index)
+	fv, ok := fieldByIndex(e.v, fi.index, false)
+	if !ok {
+		return nil, true
+	}
 	if !fv.IsValid() {
 		return nil, false
 	}
@@ -277,28 +426,42 @@ func (e *GEntity) Get(name string) (interface{}, bool) {
 
 // Fields return filted field names
 func (e *GEntity) Fields() []string {
-	l := len(e.fields)
+	fields := e.si.fields
+	l := len(fields)
 	names := make([]string, 0, l)
 	fl := len(e.filters)
 
 	for i := 0; i < l; i++ {
 		ignore := false
 		for j := 0; j < fl; j++ {
-			if e.fields[i].tag.Contains(e.filters[j]) {
+			if fields[i].tag.Contains(e.filters[j]) {
 				ignore = true
 				break
 			}
 		}
 		if !ignore {
-			names = append(names, e.fields[i].colName)
+			names = append(names, fields[i].colName)
 		}
 	}
 	return names
 }
 
-// Entity wrap a struct, provide interface Getter and Iterater
+// Entity wrap a struct, provide interface Getter and Iterater. field names are mapped by DefaultNameMapper,
+// or by DB.NameMapper when the entity is inserted or updated by DB
 func Entity(data interface{}, filters ...string) *GEntity {
-	si, err := getStructInfo(reflect.TypeOf(data))
+	return newEntity(data, nil, filters)
+}
+
+// EntityWith wrap a struct, provide interface Getter and Iterater, field names are mapped by mapper
+func EntityWith(mapper *NameMapper, data interface{}, filters ...string) *GEntity {
+	if mapper == nil {
+		panic("kdb: EntityWith mapper is nil")
+	}
+	return newEntity(data, mapper, filters)
+}
+
+func newEntity(data interface{}, mapper *NameMapper, filters []string) *GEntity {
+	si, err := getStructInfo(reflect.TypeOf(data), mapper)
 	if err != nil {
 		panic(err)
 	}
@@ -306,7 +469,8 @@ func Entity(data interface{}, filters ...string) *GEntity {
 	return &GEntity{
 		Data:    data,
 		v:       reflect.ValueOf(data),
-		fields:  si.fields,
+		si:      si,
 		filters: filters,
+		mapper:  mapper,
 	}
 }
@@ -27,7 +27,7 @@ func TestParseTag(t *testing.T) {
 func TestParseStruct(t *testing.T) {
 	var a interface{} = TypeInfoTag{}
 
-	si, err := getStructInfo(reflect.TypeOf(a))
+	si, err := getStructInfo(reflect.TypeOf(a), nil)
 	if err != nil {
 		t.Error("getStructInfo error", err)
 		return
@@ -106,3 +106,84 @@ func TestEntity(t *testing.T) {
 	}
 
 }
+
+type tBaseModel struct {
+	Id        int
+	CreatedAt string "kdb:{name=created_at}"
+}
+
+type tAddress struct {
+	City string
+	Zip  string "kdb:{name=zipcode}"
+}
+
+type tNestedEntity struct {
+	tBaseModel
+	Name    string
+	Id      int       "kdb:{name=id}"
+	Home    tAddress  "kdb:{prefix=home_}"
+	Work    *tAddress "kdb:{prefix=work_}"
+	Other   tAddress
+	Created *tBaseModel "kdb:{prefix=c_}"
+}
+
+func TestParseStructNested(t *testing.T) {
+	si, err := parseStruct(reflect.TypeOf(tNestedEntity{}), nil)
+	if err != nil {
+		t.Fatal("parseStruct error", err)
+	}
+
+	var cols []string
+	for i := 0; i < len(si.fields); i++ {
+		cols = append(cols, si.fields[i].colName)
+	}
+	want := []string{"created_at", "Name", "id", "home_City", "home_zipcode", "work_City", "work_zipcode", "Other", "c_Id", "c_created_at"}
+	if !reflect.DeepEqual(cols, want) {
+		t.Errorf("nested columns error; want=[%v]; actual=[%v]", want, cols)
+	}
+
+	if fi, _ := si.FieldByColName("id"); !reflect.DeepEqual(fi.index, []int{2}) {
+		t.Error("outer field should shadow embedded field", fi.index)
+	}
+	if fi, _ := si.FieldByColName("home_zipcode"); fi.fName != "Home.Zip" || !reflect.DeepEqual(fi.index, []int{3, 1}) {
+		t.Error("nested field error", fi.fName, fi.index)
+	}
+
+	a := tNestedEntity{Name: "a", Id: 1, Home: tAddress{City: "x"}}
+	a.CreatedAt = "now"
+	e := Entity(a)
+	if x, ok := e.Get("created_at"); x != "now" || !ok {
+		t.Error("Get embedded field error", x, ok)
+	}
+	if x, ok := e.Get("home_city"); x != "x" || !ok {
+		t.Error("Get nested field error", x, ok)
+	}
+	if x, ok := e.Get("work_city"); x != nil || !ok {
+		t.Error("Get field of nil nested struct error", x, ok)
+	}
+}
+
+func TestStructInfoCache(t *testing.T) {
+	a, _ := getStructInfo(reflect.TypeOf(struct{ A int }{}), nil)
+	b, _ := getStructInfo(reflect.TypeOf(struct{ B int }{}), nil)
+	if _, ok := a.FieldByColName("a"); !ok {
+		t.Error("struct info of anonymous struct error", a.fields)
+	}
+	if _, ok := b.FieldByColName("b"); !ok {
+		t.Error("struct info of anonymous struct shouldn't collide", b.fields)
+	}
+
+	p, _ := getStructInfo(reflect.TypeOf(&aEntity{}), nil)
+	v, _ := getStructInfo(reflect.TypeOf(aEntity{}), nil)
+	if p != v {
+		t.Error("struct info of pointer and struct should be same")
+	}
+
+	plan := v.scanPlan([]string{"none", "fa"})
+	if v.scanPlan([]string{"none", "fa"}) != plan || plan.fields[0] != nil || plan.fields[1] == nil {
+		t.Error("scan plan cache error", plan.fields)
+	}
+	if v.scanPlan([]string{"fa", "none"}) == plan {
+		t.Error("scan plan should be cached by columns")
+	}
+}
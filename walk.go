@@ -0,0 +1,303 @@
+package kdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Visitor is callbacks of Walk
+type Visitor interface {
+	// Enter is called before children of exp are walked, it return exp or a replacement of exp,
+	// children of returned expression are walked if walk is true
+	Enter(exp Expression) (replace Expression, walk bool)
+
+	// Leave is called after children of exp are walked, it return exp or a replacement of exp
+	Leave(exp Expression) (replace Expression)
+}
+
+// Walk walk expression tree in depth-first order and return root of rewritten tree.
+// Replacement of a node should fit the field that holds the node, like *Where for Query.Where,
+// Column for Set.Column and any Expression for operand of condition; nodes are rewritten in place
+func Walk(exp Expression, v Visitor) (root Expression, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ce, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			root, err = nil, ce.err
+		}
+	}()
+
+	w := &walker{v: v, tables: make(map[*Table]Expression)}
+	return w.walk(exp), nil
+}
+
+// Inspect walk expression tree in depth-first order and call fn for each node,
+// children of node are skipped if fn return false
+func Inspect(exp Expression, fn func(exp Expression) bool) {
+	Walk(exp, &funcVisitor{enter: fn})
+}
+
+// Rewrite walk expression tree in depth-first order and replace each node by fn(node),
+// fn is called after children of node are rewritten
+func Rewrite(exp Expression, fn func(exp Expression) Expression) (Expression, error) {
+	return Walk(exp, &funcVisitor{leave: fn})
+}
+
+// TablesReferenced return distinct names of tables referenced by expression,
+// derived tables and common tables of with clause are excluded
+func TablesReferenced(exp Expression) []string {
+	commons := make([]string, 0, _defaultCapicity)
+	Inspect(exp, func(e Expression) bool {
+		if w, ok := e.(*With); ok {
+			for i := 0; i < len(w.Tables); i++ {
+				commons = append(commons, w.Tables[i].Name)
+			}
+		}
+		return true
+	})
+
+	tables := make([]string, 0, _defaultCapicity)
+	Inspect(exp, func(e Expression) bool {
+		if t, ok := e.(*Table); ok && t.Query == nil && t.Name != "" && !containsFold(commons, t.Name) && !containsFold(tables, t.Name) {
+			tables = append(tables, t.Name)
+		}
+		return true
+	})
+	return tables
+}
+
+// ColumnsReferenced return distinct names of columns referenced by expression as they are written,
+// like column, table.column or table.*
+func ColumnsReferenced(exp Expression) []string {
+	columns := make([]string, 0, _defaultCapicity)
+	Inspect(exp, func(e Expression) bool {
+		var name string
+		switch c := e.(type) {
+		case Column:
+			name = string(c)
+		case *Column:
+			name = string(*c)
+		default:
+			return true
+		}
+		if name != "" && !containsFold(columns, name) {
+			columns = append(columns, name)
+		}
+		return true
+	})
+	return columns
+}
+
+// containsFold return true if list contains s, case insensitive
+func containsFold(list []string, s string) bool {
+	for i := 0; i < len(list); i++ {
+		if strings.EqualFold(list[i], s) {
+			return true
+		}
+	}
+	return false
+}
+
+// funcVisitor is Visitor of functions, nil function keeps node and walks children
+type funcVisitor struct {
+	enter func(exp Expression) bool
+	leave func(exp Expression) Expression
+}
+
+func (v *funcVisitor) Enter(exp Expression) (Expression, bool) {
+	if v.enter == nil {
+		return exp, true
+	}
+	return exp, v.enter(exp)
+}
+
+func (v *funcVisitor) Leave(exp Expression) Expression {
+	if v.leave == nil {
+		return exp
+	}
+	return v.leave(exp)
+}
+
+// walker walk expression tree by Visitor
+type walker struct {
+	v Visitor
+
+	// tables is replacement of walked tables, same table (like From.Table and Join.Left) is walked only once
+	tables map[*Table]Expression
+}
+
+// throw abort walking with an error
+func (w *walker) throw(message string) {
+	panic(compileError{err: errors.New(message)})
+}
+
+func (w *walker) walk(exp Expression) Expression {
+	if isNilExpression(exp) {
+		return exp
+	}
+
+	node := exp.Node()
+	exp, children := w.v.Enter(exp)
+	if isNilExpression(exp) {
+		w.throw("replacement is nil:" + node.String())
+	}
+	if children {
+		w.children(exp)
+	}
+
+	node = exp.Node()
+	if exp = w.v.Leave(exp); isNilExpression(exp) {
+		w.throw("replacement is nil:" + node.String())
+	}
+	return exp
+}
+
+// field walk expression stored in field, ptr is pointer to the field
+func (w *walker) field(ptr interface{}) {
+	v := reflect.ValueOf(ptr).Elem()
+	exp, ok := v.Interface().(Expression)
+	if !ok || isNilExpression(exp) {
+		return
+	}
+
+	var replace Expression
+	if t, ok := exp.(*Table); ok {
+		if replace, ok = w.tables[t]; !ok {
+			replace = w.walk(t)
+			w.tables[t] = replace
+		}
+	} else {
+		replace = w.walk(exp)
+	}
+
+	r := reflect.ValueOf(replace)
+	if !r.Type().AssignableTo(v.Type()) {
+		w.throw(fmt.Sprintf("replacement type %v doesn't fit %v", r.Type(), v.Type()))
+	}
+	v.Set(r)
+}
+
+// list walk each expression in slice, ptr is pointer to the slice
+func (w *walker) list(ptr interface{}) {
+	v := reflect.ValueOf(ptr).Elem()
+	for i := 0; i < v.Len(); i++ {
+		w.field(v.Index(i).Addr().Interface())
+	}
+}
+
+func (w *walker) conditions(c *Conditions) {
+	if c != nil {
+		w.list(&c.Conditions)
+	}
+}
+
+// children walk children of exp in order of sql
+func (w *walker) children(exp Expression) {
+	switch exp := exp.(type) {
+	case *Set:
+		w.field(&exp.Column)
+		w.field(&exp.Value)
+	case *Condition:
+		w.field(&exp.Left)
+		w.field(&exp.Right)
+		w.field(&exp.High)
+	case *Aggregate:
+		w.field(&exp.Exp)
+	case *Call:
+		w.list(&exp.Args)
+	case *Case:
+		w.field(&exp.Exp)
+		for i := 0; i < len(exp.Whens); i++ {
+			w.field(&exp.Whens[i].Value)
+			w.conditions(exp.Whens[i].Conditions)
+			w.field(&exp.Whens[i].Result)
+		}
+		w.field(&exp.Else)
+	case *Window:
+		w.field(&exp.Func)
+		w.list(&exp.PartitionBy)
+		w.field(&exp.OrderBy)
+	case *Where:
+		w.conditions(exp.Conditions)
+	case *Having:
+		w.conditions(exp.Conditions)
+	case *GroupBy:
+		w.list(&exp.Fields)
+	case *Table:
+		w.field(&exp.Query)
+	case *Select:
+		for i := 0; i < len(exp.Fields); i++ {
+			w.field(&exp.Fields[i].Exp)
+		}
+	case *OrderBy:
+		for i := 0; i < len(exp.Fields); i++ {
+			w.field(&exp.Fields[i].Exp)
+		}
+	case *From:
+		w.field(&exp.Table)
+		w.list(&exp.Tables)
+		w.list(&exp.Joins)
+	case *Join:
+		w.field(&exp.Left)
+		w.field(&exp.Right)
+		w.conditions(exp.Conditions)
+	case *Output:
+		w.list(&exp.Columns)
+	case *With:
+		for i := 0; i < len(exp.Tables); i++ {
+			w.field(&exp.Tables[i].Query)
+		}
+	case *Text:
+		w.list(&exp.Parameters)
+	case *Procedure:
+		w.list(&exp.Parameters)
+	case *Insert:
+		w.field(&exp.Table)
+		w.list(&exp.Sets)
+		for i := 0; i < len(exp.Rows); i++ {
+			w.list(&exp.Rows[i])
+		}
+		w.list(&exp.Columns)
+		w.field(&exp.Query)
+		w.field(&exp.Output)
+	case *Upsert:
+		w.field(&exp.Table)
+		w.list(&exp.Sets)
+		w.list(&exp.Keys)
+	case *Update:
+		w.field(&exp.With)
+		w.field(&exp.Table)
+		w.list(&exp.Sets)
+		w.field(&exp.From)
+		w.field(&exp.Where)
+		w.field(&exp.OrderBy)
+		w.field(&exp.Output)
+	case *Delete:
+		w.field(&exp.With)
+		w.field(&exp.Table)
+		w.field(&exp.From)
+		w.field(&exp.Where)
+		w.field(&exp.OrderBy)
+		w.field(&exp.Output)
+	case *Query:
+		w.field(&exp.With)
+		w.field(&exp.Select)
+		w.field(&exp.From)
+		w.field(&exp.Where)
+		w.field(&exp.GroupBy)
+		w.field(&exp.Having)
+		w.field(&exp.OrderBy)
+		w.field(&exp.Lock)
+	case *Compound:
+		w.field(&exp.With)
+		w.field(&exp.Query)
+		for i := 0; i < len(exp.Queries); i++ {
+			w.field(&exp.Queries[i].Query)
+		}
+		w.field(&exp.OrderBy)
+	}
+}
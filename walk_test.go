@@ -0,0 +1,137 @@
+package kdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tenantVisitor append tenant filter to each query that selects from table person
+type tenantVisitor struct {
+	entered []NodeType
+}
+
+func (v *tenantVisitor) Enter(exp Expression) (Expression, bool) {
+	v.entered = append(v.entered, exp.Node())
+	return exp, exp.Node() != NodeLock
+}
+
+func (v *tenantVisitor) Leave(exp Expression) Expression {
+	if q, ok := exp.(*Query); ok && q.From != nil && q.From.FindTable("person") != nil {
+		q.Where.Equals("tenant", 7)
+	}
+	return exp
+}
+
+func TestWalk(t *testing.T) {
+	sub := NewQuery("person", "")
+	sub.Select.Column("city")
+
+	q := NewQuery("city", "c")
+	q.Select.Column("c.name", "c.id")
+	q.From.InnerJoin("country", "n").On("c.country", "n.id")
+	q.Where.In("c.id", sub).Equals("n.code", "cn")
+	q.UseOrderBy().Asc("c.name")
+	q.UseWith().Table("big", NewQuery("person", ""))
+
+	tables := TablesReferenced(q)
+	if want := []string{"person", "city", "country"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables referenced error; want=[%v]; actual=[%v]", want, tables)
+	}
+	if tables := TablesReferenced(NewQuery("big", "")); len(tables) != 1 {
+		t.Error("tables referenced error", tables)
+	}
+
+	columns := ColumnsReferenced(q)
+	if want := []string{"c.name", "c.id", "c.country", "n.id", "city", "n.code"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns referenced error; want=[%v]; actual=[%v]", want, columns)
+	}
+
+	v := &tenantVisitor{}
+	root, err := Walk(q, v)
+	if err != nil || root != q {
+		t.Fatal("walk error", err)
+	}
+	if v.entered[0] != NodeQuery || v.entered[1] != NodeWith {
+		t.Error("walk order error", v.entered)
+	}
+
+	query, args, _ := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q)
+	want := `WITH big AS (SELECT * FROM person WHERE tenant = $1)
+		SELECT c.name, c.id FROM city AS c INNER JOIN country AS n ON c.country = n.id
+		WHERE c.id IN (SELECT city FROM person WHERE tenant = $2) AND n.code = $3 ORDER BY c.name ASC;`
+	if removeSpace(query) != removeSpace(want) || len(args) != 3 {
+		t.Error("walk rewrite sql error", "\n", query, "\n", want)
+	}
+
+	u := NewUpdate("person").Set("name", "a")
+	u.Where.Equals("name", "b")
+	_, err = Rewrite(u, func(exp Expression) Expression {
+		if c, ok := exp.(Column); ok && c == "name" {
+			return Column("full_name")
+		}
+		return exp
+	})
+	if err != nil {
+		t.Fatal("rewrite error", err)
+	}
+	query, _, _ = NewSqlDriver(PostgreSQLDialecter{}).Compile("source", u)
+	if want := `UPDATE person SET full_name = $1 WHERE full_name = $2;`; removeSpace(query) != removeSpace(want) {
+		t.Error("rewrite column sql error", "\n", query, "\n", want)
+	}
+
+	_, err = Rewrite(NewQuery("person", ""), func(exp Expression) Expression {
+		if exp.Node() == NodeWhere {
+			return NewHaving()
+		}
+		return exp
+	})
+	if err == nil || !strings.Contains(err.Error(), "doesn't fit") {
+		t.Error("rewrite with wrong type should return error", err)
+	}
+
+	if _, err = Rewrite(NewQuery("person", ""), func(exp Expression) Expression { return nil }); err == nil {
+		t.Error("rewrite with nil should return error")
+	}
+}
+
+func TestWalkJoin(t *testing.T) {
+	q := NewQuery("orders", "o")
+	q.Select.Column("o.id", "c.name")
+	q.From.LeftJoin("customer", "c").On("o.customer", "c.id")
+
+	count := 0
+	Inspect(q, func(exp Expression) bool {
+		if tb, ok := exp.(*Table); ok && tb.Name == "orders" {
+			count++
+		}
+		return true
+	})
+	if count != 1 {
+		t.Errorf("table of from and left of join should be walked once; actual=[%v]", count)
+	}
+
+	_, err := Rewrite(q, func(exp Expression) Expression {
+		if tb, ok := exp.(*Table); ok {
+			tb.Name = "t1_" + tb.Name
+		}
+		return exp
+	})
+	if err != nil {
+		t.Fatal("rewrite join error", err)
+	}
+	query, _, _ := NewSqlDriver(PostgreSQLDialecter{}).Compile("source", q)
+	if want := `SELECT o.id, c.name FROM t1_orders AS o LEFT JOIN t1_customer AS c ON o.customer = c.id;`; removeSpace(query) != removeSpace(want) {
+		t.Error("rewrite join sql error", "\n", query, "\n", want)
+	}
+
+	_, err = Rewrite(q, func(exp Expression) Expression {
+		if tb, ok := exp.(*Table); ok && tb.Name == "t1_orders" {
+			return newTable("t2_orders", "o")
+		}
+		return exp
+	})
+	if err != nil || q.From.Table != q.From.Joins[0].Left || q.From.Table.Name != "t2_orders" {
+		t.Error("replacement of table should be shared by from and join", err, q.From.Table, q.From.Joins[0].Left)
+	}
+}